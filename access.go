@@ -0,0 +1,263 @@
+package lama
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/middleware/accesslog"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+// AccessConf 配置[access]
+//
+// format: text(默认)、common、combined、json，或包含 {{ }} 的自定义模板，模板数据为 AccessRecord
+// fields: latency、ip、bytesIn、bytesOut、requestId、user、route、referer、userAgent
+// skip: 不记录的路径，以 * 结尾时按前缀匹配
+// sample: 采样率 (0,1]，默认全部记录
+type AccessConf struct {
+	Format string   `json:"format"`
+	Fields []string `json:"fields"`
+	Skip   []string `json:"skip"`
+	Sample float64  `json:"sample"`
+}
+
+// newAccessLog 按配置[access]创建访问日志中间件，输出到 log.access
+func newAccessLog() context.Handler {
+	var cfg AccessConf
+	err := Conf.Define("access", AccessConf{})
+	if err == nil && Conf.Exists("access") {
+		err = Conf.Structure("access", &cfg)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = "text"
+		if Conf.String("app.logFormat") == "json" {
+			cfg.Format = "json"
+		}
+	}
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = []string{"latency", "ip", "requestId"}
+	}
+
+	ac := accesslog.New(accessLog.Printer)
+	if cfg.Format == "text" {
+		ac.IP = hasString(cfg.Fields, "ip")
+		ac.BytesReceivedBody = hasString(cfg.Fields, "bytesIn")
+		ac.BytesSentBody = hasString(cfg.Fields, "bytesOut")
+		ac.AddFields(func(ctx *context.Context, fields *accesslog.Fields) {
+			rec := &AccessRecord{Ctx: ctx}
+			for _, name := range []string{"requestId", "user", "route"} {
+				if v := rec.field(name); hasString(cfg.Fields, name) && v != "" {
+					fields.Set(name, v)
+				}
+			}
+		})
+	} else {
+		f := &accessFormatter{cfg: cfg}
+		if strings.Contains(cfg.Format, "{{") {
+			f.tmpl = template.Must(template.New("access").Parse(cfg.Format))
+		}
+		ac.SetFormatter(f)
+	}
+
+	return func(ctx *context.Context) {
+		if accessSkip(cfg, ctx.Path()) {
+			ctx.Next()
+			return
+		}
+		ac.Handler(ctx)
+	}
+}
+
+func accessSkip(cfg AccessConf, path string) bool {
+	for _, p := range cfg.Skip {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return cfg.Sample > 0 && cfg.Sample < 1 && rand.Float64() >= cfg.Sample
+}
+
+// AccessRecord 访问日志记录
+type AccessRecord struct {
+	Time     time.Time
+	Latency  time.Duration
+	Status   int
+	Method   string
+	Path     string
+	IP       string
+	BytesIn  int
+	BytesOut int
+	Ctx      *context.Context
+}
+
+func (s *AccessRecord) RequestID() string {
+	return requestid.Get(s.Ctx)
+}
+
+func (s *AccessRecord) User() string {
+	if u := s.Ctx.User(); u != nil {
+		name, _ := u.GetUsername()
+		if name == "" {
+			name, _ = u.GetID()
+		}
+		return name
+	}
+	return ""
+}
+
+func (s *AccessRecord) Route() string {
+	if r := s.Ctx.GetCurrentRoute(); r != nil {
+		return r.Path()
+	}
+	return ""
+}
+
+func (s *AccessRecord) Referer() string {
+	return s.Ctx.GetHeader("Referer")
+}
+
+func (s *AccessRecord) UserAgent() string {
+	return s.Ctx.GetHeader("User-Agent")
+}
+
+func (s *AccessRecord) Request() string {
+	uri := s.Path
+	if q := s.Ctx.Request().URL.RawQuery; q != "" {
+		uri += "?" + q
+	}
+	return fmt.Sprintf("%s %s %s", s.Method, uri, s.Ctx.Request().Proto)
+}
+
+func (s *AccessRecord) field(name string) string {
+	switch name {
+	case "requestId":
+		return s.RequestID()
+	case "user":
+		return s.User()
+	case "route":
+		return s.Route()
+	case "referer":
+		return s.Referer()
+	case "userAgent":
+		return s.UserAgent()
+	}
+	return ""
+}
+
+// Common 返回 Common Log Format 格式
+func (s *AccessRecord) Common() string {
+	return fmt.Sprintf(`%s - %s [%s] "%s" %d %d`,
+		orDash(s.IP), orDash(s.User()), s.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		s.Request(), s.Status, s.BytesOut)
+}
+
+// Combined 返回 Combined Log Format 格式
+func (s *AccessRecord) Combined() string {
+	return fmt.Sprintf(`%s "%s" "%s"`, s.Common(), orDash(s.Referer()), orDash(s.UserAgent()))
+}
+
+// accessFormatter 按配置[access]格式输出访问日志
+type accessFormatter struct {
+	cfg  AccessConf
+	tmpl *template.Template
+	dest io.Writer
+}
+
+func (s *accessFormatter) SetOutput(dest io.Writer) {
+	s.dest = dest
+}
+
+func (s *accessFormatter) Format(log *accesslog.Log) (bool, error) {
+	rec := &AccessRecord{
+		Time:     log.Now,
+		Latency:  log.Latency,
+		Status:   log.Code,
+		Method:   log.Method,
+		Path:     log.Path,
+		IP:       log.IP,
+		BytesIn:  log.BytesReceived,
+		BytesOut: log.BytesSent,
+		Ctx:      log.Ctx,
+	}
+
+	var line string
+	switch s.cfg.Format {
+	case "json":
+		fields := Fields{
+			"status": rec.Status,
+			"method": rec.Method,
+			"path":   rec.Path,
+		}
+		for _, name := range s.cfg.Fields {
+			switch name {
+			case "latency":
+				fields[name] = rec.Latency.Milliseconds()
+			case "ip":
+				fields[name] = rec.IP
+			case "bytesIn":
+				fields[name] = rec.BytesIn
+			case "bytesOut":
+				fields[name] = rec.BytesOut
+			default:
+				if v := rec.field(name); v != "" {
+					fields[name] = v
+				}
+			}
+		}
+		for _, f := range log.Fields {
+			fields[f.Key] = f.ValueRaw
+		}
+		accessLog.Info("access", fields)
+		return true, nil
+
+	case "common":
+		line = rec.Common()
+
+	case "combined":
+		line = rec.Combined()
+
+	default:
+		if s.tmpl == nil {
+			return false, nil
+		}
+		buf := new(bytes.Buffer)
+		err := s.tmpl.Execute(buf, rec)
+		if err != nil {
+			return false, err
+		}
+		line = buf.String()
+	}
+
+	_, err := s.dest.Write([]byte(line + "\n"))
+	return true, err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func hasString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -3,8 +3,6 @@ package lama
 import (
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/core/router"
-	"github.com/kataras/iris/v12/middleware/accesslog"
-	"github.com/kataras/iris/v12/middleware/cors"
 	"github.com/kataras/iris/v12/middleware/requestid"
 	"github.com/kataras/iris/v12/mvc"
 )
@@ -24,22 +22,29 @@ var App IRISApp
 func NewIRISApp() IRISApp {
 	if App == nil {
 		App = iris.New()
+		registerLog("iris", App.Logger())
 
 		if Conf.Bool("app.accesslog") {
-			App.UseRouter(accesslog.New(Print.Printer).Handler)
+			App.UseRouter(newAccessLog())
 		}
 
 		if Conf.Bool("app.recover") {
 			r := &Recover{debug: Conf.Bool("app.debug")}
-			r.Init(App)
+			err := r.Init(App)
+			if err != nil {
+				panic(err)
+			}
 		}
 
 		App.UseRouter(requestid.New())
-		App.UseRouter(cors.New().
-			ExtractOriginFunc(cors.DefaultOriginExtractor).
-			ReferrerPolicy(cors.NoReferrerWhenDowngrade).
-			AllowOriginFunc(cors.AllowAnyOrigin).
-			Handler())
+		App.UseRouter(requestLogger)
+		App.UseRouter(traceRequest)
+		App.UseRouter(httpMetrics)
+		App.UseRouter(slowRequest)
+		App.UseRouter(requestTimeout)
+		App.UseRouter(newCors())
+		App.UseRouter(newRateLimit())
+		App.UseRouter(listenerMiddleware)
 
 		var disableStartupLog bool
 		debug := Conf.Bool("app.debug")
@@ -53,6 +58,7 @@ func NewIRISApp() IRISApp {
 			iris.WithConfiguration(iris.Configuration{
 				PostMaxMemory:     100 << 20,
 				DisableStartupLog: disableStartupLog,
+				LogLevel:          logLevel("iris"),
 			}),
 		}
 
@@ -65,13 +71,33 @@ func NewIRISApp() IRISApp {
 type Act struct {
 }
 
-func (s *Act) Provide() (IRISApp, NewMvcApp, Version, Deprecated, NewParty, NewMvc) {
+// Init 使用服务提供的错误上报、追踪导出和限流存储，未提供错误上报时为 FileReporter，未提供追踪导出时按配置[trace]，未提供限流存储时使用内存
+func (s *Act) Init(r ErrorReporter, e SpanExporter, rs RateStore) error {
+	if r != nil {
+		reporter = r
+	}
+	if rs != nil {
+		rateStore = rs
+	}
+	return initTracer(e)
+}
+
+func (s *Act) Stop() error {
+	flushTraces()
+	return nil
+}
+
+func (s *Act) Provide() (IRISApp, *Admin, NewMvcApp, Version, Deprecated, NewParty, NewMvc) {
 	app := NewIRISApp()
+	newMvcApp := func(party router.Party) MVCApp {
+		return mvc.New(party).HandleError(handleError)
+	}
 	newMvc := func(path string) MVCApp {
-		return mvc.New(app.APIBuilder.Party(path))
+		return newMvcApp(app.APIBuilder.Party(path))
 	}
 	return app,
-		mvc.New,
+		NewAdminApp(),
+		newMvcApp,
 		mvc.Version,
 		mvc.Deprecated,
 		app.APIBuilder.Party,
@@ -6,6 +6,14 @@ import (
 	"sync"
 )
 
+// optionalDeps 可选的依赖类型，没有服务提供时注入 nil，其它依赖缺少时 Init 返回错误
+var optionalDeps = map[reflect.Type]bool{
+	reflect.TypeOf((*ErrorReporter)(nil)).Elem(): true,
+	reflect.TypeOf((*SpanExporter)(nil)).Elem():  true,
+	reflect.TypeOf((*RateStore)(nil)).Elem():     true,
+	reflect.TypeOf((*ReplayStore)(nil)).Elem():   true,
+}
+
 // NewAda returns a new instance of Ada.
 func NewAda() *Ada {
 	return &Ada{
@@ -67,7 +75,7 @@ func (s *Ada) Services(service interface{}) error {
 						return fmt.Errorf("provide value [%s] is not a valid struct in %v", name, reflect.TypeOf(service))
 					}
 				} else {
-					if kind != reflect.Func {
+					if kind != reflect.Func && kind != reflect.Interface {
 						return fmt.Errorf("provide value [%s] is not a valid pointer in %v", out.String(), reflect.TypeOf(service))
 					}
 				}
@@ -84,6 +92,7 @@ func (s *Ada) Services(service interface{}) error {
 // Init initializes all registered services.
 func (s *Ada) Init() error {
 	eType := reflect.TypeOf((*error)(nil)).Elem()
+	lType := reflect.TypeOf(Print)
 	for _, srv := range s.services {
 		method := srv.MethodByName("Init")
 		if !method.IsValid() {
@@ -98,7 +107,17 @@ func (s *Ada) Init() error {
 
 		for i := 0; i < numIn; i++ {
 			argType := method.Type().In(i)
+			if argType == lType {
+				// 配置了 log.levels.<服务名> 时提供子日志，否则与之前一样为 Print
+				args[i] = reflect.ValueOf(serviceLog(srv.Elem().Type().Name()))
+				continue
+			}
 			argValue, exists := s.values[argType]
+			if !exists && optionalDeps[argType] {
+				// 可选的依赖，未提供时为 nil
+				args[i] = reflect.Zero(argType)
+				continue
+			}
 			if !exists {
 				return fmt.Errorf("missing dependency [%v] for service %s", argType, srv)
 			}
@@ -132,6 +151,7 @@ func (s *Ada) Serve() <-chan error {
 		if !method.IsValid() {
 			continue
 		}
+		name := srv.Elem().Type().Name()
 
 		typ := method.Type()
 		numIn := typ.NumIn()
@@ -143,6 +163,7 @@ func (s *Ada) Serve() <-chan error {
 				wg.Add(1)
 				itf := method.Call([]reflect.Value{})[0].Interface()
 				if itf != nil {
+					serviceErrors.Inc(name)
 					out <- itf.(error)
 				}
 				wg.Done()
@@ -153,6 +174,7 @@ func (s *Ada) Serve() <-chan error {
 				if itf != nil {
 					go func() {
 						for err := range itf.(chan error) {
+							serviceErrors.Inc(name)
 							out <- err
 						}
 						wg.Done()
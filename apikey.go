@@ -0,0 +1,425 @@
+package lama
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+// APIKeyConf 配置[apikey]
+//
+// window: 签名时间戳允许的偏差秒数，默认 300
+// requireSignature: 为 true 时只接受签名请求
+// pepper: 派生签名密钥的服务端密钥，至少 32 字节，不保存在数据库中，为空时不接受签名请求
+// maxBody: 签名请求读取的最大请求体字节数，默认 1MB
+type APIKeyConf struct {
+	Table            string `json:"table"`
+	Header           string `json:"header"`
+	Window           int    `json:"window"`
+	RequireSignature bool   `json:"requireSignature"`
+	Pepper           string `json:"pepper"`
+	MaxBody          int64  `json:"maxBody"`
+}
+
+// APIKey 服务间调用的 API key 认证，key 只保存 SHA-256 摘要
+//
+//	CREATE TABLE api_keys (
+//		id TEXT PRIMARY KEY,
+//		name TEXT NOT NULL,
+//		hash TEXT NOT NULL,
+//		scopes TEXT NOT NULL DEFAULT '',
+//		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+//		revoked_at TIMESTAMPTZ
+//	)
+//
+// key 的格式为 lk_<id>_<secret>，请求方式二选一:
+//
+//	X-API-Key: lk_<id>_<secret>
+//
+// 或签名，签名密钥为 HMAC-SHA256(pepper, hex(sha256(secret)))，只在创建时显示，
+// 数据库中的摘要没有 pepper 时不能用于签名:
+//
+//	X-API-Key-Id: <id>
+//	X-Timestamp: <unix 秒>
+//	X-Signature: hex(HMAC-SHA256(签名密钥, METHOD\nPATH?QUERY\nTIMESTAMP\nhex(sha256(body))))
+//
+// 同一签名在时间窗口内只能使用一次，默认只在本进程内记录，多实例部署时由服务 Provide() ReplayStore 共享
+type APIKey struct {
+	cfg    APIKeyConf
+	db     *Database
+	replay ReplayStore
+}
+
+// ReplayStore 记录已使用的签名
+type ReplayStore interface {
+	// Remember 记录 key，ttl 内已记录过时返回 false
+	Remember(key string, ttl time.Duration) (bool, error)
+}
+
+// APIKeyInfo 调用方身份
+type APIKeyInfo struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+const apiKeyInfoKey = "lama.apiKey"
+
+var (
+	ErrAPIKeyInvalid    = Unauthorized("invalid api key").WithCode("api_key_invalid")
+	ErrSignatureInvalid = Unauthorized("invalid signature").WithCode("signature_invalid")
+	ErrSignatureExpired = Unauthorized("signature expired").WithCode("signature_expired")
+	ErrSignatureReplay  = Unauthorized("signature already used").WithCode("signature_replay")
+	ErrBodyTooLarge     = NewError(http.StatusRequestEntityTooLarge, "body_too_large", "")
+)
+
+func (s *APIKey) Provide() *APIKey {
+	return s
+}
+
+func (s *APIKey) Init(db SqlxDB, rs ReplayStore) error {
+	err := Conf.Define("apikey", APIKeyConf{})
+	if err != nil {
+		return err
+	}
+
+	if Conf.Exists("apikey") {
+		err = Conf.Structure("apikey", &s.cfg)
+		if err != nil {
+			return err
+		}
+	}
+	if s.cfg.Table == "" {
+		s.cfg.Table = "api_keys"
+	}
+	if s.cfg.Header == "" {
+		s.cfg.Header = "X-API-Key"
+	}
+	if s.cfg.Window <= 0 {
+		s.cfg.Window = 300
+	}
+	if s.cfg.MaxBody <= 0 {
+		s.cfg.MaxBody = 1 << 20
+	}
+	if s.cfg.Pepper != "" && len(s.cfg.Pepper) < minHMACKey {
+		return fmt.Errorf("apikey: pepper must be at least %d bytes", minHMACKey)
+	}
+	if s.cfg.RequireSignature && s.cfg.Pepper == "" {
+		return fmt.Errorf("apikey: requireSignature needs apikey.pepper")
+	}
+
+	s.db = &Database{db: db}
+	s.replay = rs
+	if s.replay == nil {
+		s.replay = NewMemoryReplayStore()
+	}
+
+	RegisterCommand(Command{
+		Name:  "apikey",
+		Usage: "create -name <name> [-scopes \"a b\"] | revoke <id> | list",
+		Run:   s.command,
+	})
+	return nil
+}
+
+// Verify 要求请求带有有效的 API key 或签名，身份以声明放入请求，可使用 RequireScopes
+//
+//	party.Use(apiKey.Verify, lama.RequireScopes("orders:read"))
+func (s *APIKey) Verify(ctx *context.Context) {
+	info, err := s.authenticate(ctx)
+	if err != nil {
+		renderError(ctx, err, false, nil)
+		return
+	}
+
+	ctx.Values().Set(apiKeyInfoKey, info)
+	SetClaims(ctx, Claims{
+		"sub":   "apikey:" + info.ID,
+		"name":  info.Name,
+		"scope": strings.Join(info.Scopes, " "),
+	})
+	ctx.Next()
+}
+
+// APIKeyFrom 返回请求的调用方，未通过 API key 认证时为 nil
+func APIKeyFrom(ctx *context.Context) *APIKeyInfo {
+	info, _ := ctx.Values().Get(apiKeyInfoKey).(*APIKeyInfo)
+	return info
+}
+
+func (s *APIKey) authenticate(ctx *context.Context) (info *APIKeyInfo, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = er
+			} else {
+				panic(e)
+			}
+		}
+	}()
+
+	if id := ctx.GetHeader("X-API-Key-Id"); id != "" {
+		return s.verifySignature(ctx, id)
+	}
+	if s.cfg.RequireSignature {
+		return nil, ErrSignatureInvalid
+	}
+
+	id, secret, ok := parseAPIKey(ctx.GetHeader(s.cfg.Header))
+	if !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+	info, hash := s.lookup(id)
+	if info == nil || subtle.ConstantTimeCompare([]byte(hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+	return info, nil
+}
+
+func (s *APIKey) verifySignature(ctx *context.Context, id string) (*APIKeyInfo, error) {
+	if s.cfg.Pepper == "" {
+		return nil, ErrSignatureInvalid
+	}
+	info, hash := s.lookup(id)
+	if info == nil {
+		return nil, ErrSignatureInvalid
+	}
+	err := s.checkSignature(ctx, id, hash)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// checkSignature 校验时间戳、签名和重放，hash 为数据库中保存的摘要
+func (s *APIKey) checkSignature(ctx *context.Context, id, hash string) error {
+	ts, err := strconv.ParseInt(ctx.GetHeader("X-Timestamp"), 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	window := time.Duration(s.cfg.Window) * time.Second
+	if d := time.Since(time.Unix(ts, 0)); d > window || d < -window {
+		return ErrSignatureExpired
+	}
+
+	sig, err := hex.DecodeString(ctx.GetHeader("X-Signature"))
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+
+	// 多读一个字节判断是否超过 maxBody
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, s.cfg.MaxBody+1))
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	if int64(len(body)) > s.cfg.MaxBody {
+		return ErrBodyTooLarge
+	}
+	ctx.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+	if !hmac.Equal(sig, SignRequest(s.signingKey(hash), ctx.Method(), ctx.Request().URL.RequestURI(), ts, body)) {
+		return ErrSignatureInvalid
+	}
+	// 时间戳可以偏差 window，签名在 2*window 内都可能被重放
+	ok, err := s.replay.Remember(id+":"+hex.EncodeToString(sig), 2*window)
+	if err != nil {
+		// 无法判断是否重放时拒绝
+		Logger(ctx).Errorf("Replay Store Failed %v", err)
+		return Unavailable("").Wrap(err)
+	}
+	if !ok {
+		return ErrSignatureReplay
+	}
+	return nil
+}
+
+// signingKey 由 pepper 和数据库中的摘要派生签名密钥
+func (s *APIKey) signingKey(hash string) []byte {
+	mac := hmac.New(sha256.New, []byte(s.cfg.Pepper))
+	mac.Write([]byte(hash))
+	return mac.Sum(nil)
+}
+
+// SigningKey 返回 key 的签名密钥，未配置 pepper 或 key 格式错误时返回 nil
+func (s *APIKey) SigningKey(key string) []byte {
+	_, secret, ok := parseAPIKey(key)
+	if !ok || s.cfg.Pepper == "" {
+		return nil
+	}
+	return s.signingKey(hashSecret(secret))
+}
+
+// SignRequest 计算请求签名，key 为创建时显示的签名密钥，供调用方使用
+func SignRequest(key []byte, method, uri string, ts int64, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%s", method, uri, ts, hex.EncodeToString(sum[:]))
+	return mac.Sum(nil)
+}
+
+// MemoryReplayStore 内存签名记录，只在本进程内有效，每分钟清理过期的记录
+type MemoryReplayStore struct {
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	swept time.Time
+}
+
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{seen: make(map[string]time.Time), swept: time.Now()}
+}
+
+func (s *MemoryReplayStore) Remember(key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) >= time.Minute {
+		s.swept = now
+		for k, exp := range s.seen {
+			if now.After(exp) {
+				delete(s.seen, k)
+			}
+		}
+	}
+
+	if exp, ok := s.seen[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.seen[key] = now.Add(ttl)
+	return true, nil
+}
+
+// lookup 查询未吊销的 key，返回身份和摘要
+func (s *APIKey) lookup(id string) (*APIKeyInfo, string) {
+	row := s.db.Get(s.cfg.Table, func(sel *Sql, where *Sql) {
+		sel.Space("id,name,hash,scopes")
+		where.Space("id=? AND revoked_at IS NULL", id)
+	})
+	if row == nil {
+		return nil, ""
+	}
+	return &APIKeyInfo{
+		ID:     row.Get("id").String(),
+		Name:   row.Get("name").String(),
+		Scopes: strings.Fields(row.Get("scopes").String()),
+	}, row.Get("hash").String()
+}
+
+// Create 创建 key，返回的 key 只在创建时可见
+func (s *APIKey) Create(name string, scopes ...string) (id, key string) {
+	id = randomToken(8)
+	secret := randomToken(24)
+	s.db.Add(s.cfg.Table, map[string]any{
+		"id":     id,
+		"name":   name,
+		"hash":   hashSecret(secret),
+		"scopes": strings.Join(scopes, " "),
+	})
+	return id, "lk_" + id + "_" + secret
+}
+
+// Revoke 吊销 key
+func (s *APIKey) Revoke(id string) bool {
+	return s.db.Save(s.cfg.Table, map[string]any{"revoked_at": time.Now()}, func(where *Sql) {
+		where.Space("id=? AND revoked_at IS NULL", id)
+	}).Ok()
+}
+
+// command 处理 apikey create/revoke/list
+func (s *APIKey) command(args []string) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = er
+			} else {
+				panic(e)
+			}
+		}
+	}()
+
+	if len(args) == 0 {
+		return fmt.Errorf("usage: apikey create|revoke|list")
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := fs.String("name", "", "caller name")
+		scopes := fs.String("scopes", "", "space separated scopes")
+		err := fs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if *name == "" {
+			return fmt.Errorf("apikey create: -name is required")
+		}
+		id, key := s.Create(*name, strings.Fields(*scopes)...)
+		fmt.Printf("id:   %s\nkey:  %s\n", id, key)
+		if sk := s.SigningKey(key); sk != nil {
+			fmt.Printf("sign: %s\n", hex.EncodeToString(sk))
+		}
+
+	case "revoke":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: apikey revoke <id>")
+		}
+		if !s.Revoke(args[1]) {
+			return fmt.Errorf("apikey %s not found or already revoked", args[1])
+		}
+		fmt.Printf("revoked %s\n", args[1])
+
+	case "list":
+		rows := s.db.Select(s.cfg.Table, func(sel *Sql, where *Sql) {
+			sel.Space("id,name,scopes,created_at,revoked_at")
+		})
+		for _, row := range rows {
+			state := "active"
+			if row.Get("revoked_at").NotNull() {
+				state = "revoked " + row.Get("revoked_at").String()
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\t%s\n", row.Get("id").String(), row.Get("name").String(),
+				row.Get("scopes").String(), row.Get("created_at").String(), state)
+		}
+
+	default:
+		return fmt.Errorf("apikey: unknown command %s", args[0])
+	}
+	return nil
+}
+
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(key, "lk_") {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(key[3:], "_")
+	return id, secret, ok && id != "" && secret != ""
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken 返回 n 字节随机数的 base64url 编码，不含 _ 以便分隔
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return strings.ReplaceAll(base64.RawURLEncoding.EncodeToString(b), "_", "-")
+}
@@ -0,0 +1,116 @@
+package lama
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestAPIKeySignature(t *testing.T) {
+	s := &APIKey{
+		cfg:    APIKeyConf{Window: 300, Pepper: testSecret, MaxBody: 16},
+		replay: NewMemoryReplayStore(),
+	}
+	key := "lk_k1_secret"
+	hash := hashSecret("secret")
+	signKey := s.SigningKey(key)
+	storedHash, _ := hex.DecodeString(hash)
+
+	now := time.Now().Unix()
+	body := []byte(`{"a":1}`)
+	valid := SignRequest(signKey, http.MethodPost, "/orders?x=1", now, body)
+
+	tests := []struct {
+		name string
+		ts   int64
+		sig  []byte
+		body []byte
+		err  error
+	}{
+		{"valid", now, valid, body, nil},
+		{"replay", now, valid, body, ErrSignatureReplay},
+		{"stored hash as key", now, SignRequest(storedHash, http.MethodPost, "/orders?x=1", now, body), body, ErrSignatureInvalid},
+		{"tampered body", now, SignRequest(signKey, http.MethodPost, "/orders?x=1", now, body), []byte(`{"a":2}`), ErrSignatureInvalid},
+		{"expired", now - 600, SignRequest(signKey, http.MethodPost, "/orders?x=1", now-600, body), body, ErrSignatureExpired},
+		{"body too large", now, SignRequest(signKey, http.MethodPost, "/orders?x=1", now, bytes.Repeat(body, 3)), bytes.Repeat(body, 3), ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/orders?x=1", bytes.NewReader(tt.body))
+			req.Header.Set("X-Timestamp", strconv.FormatInt(tt.ts, 10))
+			req.Header.Set("X-Signature", hex.EncodeToString(tt.sig))
+
+			var err error
+			var read []byte
+			testServe(req, func(ctx *context.Context) {
+				err = s.checkSignature(ctx, "k1", hash)
+				read, _ = io.ReadAll(ctx.Request().Body)
+				ctx.Next()
+			})
+
+			if err != tt.err {
+				t.Fatalf("checkSignature() err = %v, want %v", err, tt.err)
+			}
+			if err == nil && !bytes.Equal(read, tt.body) {
+				t.Errorf("body = %q, want %q", read, tt.body)
+			}
+		})
+	}
+}
+
+type failReplayStore struct{}
+
+func (failReplayStore) Remember(string, time.Duration) (bool, error) {
+	return false, errors.New("store down")
+}
+
+func TestAPIKeyReplayStoreFailed(t *testing.T) {
+	s := &APIKey{
+		cfg:    APIKeyConf{Window: 300, Pepper: testSecret, MaxBody: 16},
+		replay: failReplayStore{},
+	}
+	hash := hashSecret("secret")
+	now := time.Now().Unix()
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	req.Header.Set("X-Timestamp", strconv.FormatInt(now, 10))
+	req.Header.Set("X-Signature", hex.EncodeToString(SignRequest(s.signingKey(hash), http.MethodPost, "/orders", now, nil)))
+
+	var err error
+	testServe(req, func(ctx *context.Context) {
+		err = s.checkSignature(ctx, "k1", hash)
+		ctx.Next()
+	})
+	if e, ok := err.(*Error); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Fatalf("checkSignature() err = %v, want 503", err)
+	}
+}
+
+func TestAPIKeySigningKey(t *testing.T) {
+	s := &APIKey{}
+	if k := s.SigningKey("lk_k1_secret"); k != nil {
+		t.Errorf("SigningKey() without pepper = %x, want nil", k)
+	}
+
+	s.cfg.Pepper = testSecret
+	if k := s.SigningKey("k1_secret"); k != nil {
+		t.Errorf("SigningKey() of malformed key = %x, want nil", k)
+	}
+	want := s.signingKey(hashSecret("secret"))
+	if k := s.SigningKey("lk_k1_secret"); !bytes.Equal(k, want) {
+		t.Errorf("SigningKey() = %x, want %x", k, want)
+	}
+
+	// pepper 不同时签名密钥不同，只有数据库中的摘要不能签名
+	s.cfg.Pepper = testSecret + "x"
+	if k := s.SigningKey("lk_k1_secret"); bytes.Equal(k, want) {
+		t.Errorf("SigningKey() with another pepper = %x, want different", k)
+	}
+}
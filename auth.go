@@ -0,0 +1,642 @@
+package lama
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+// AuthKey 验证 JWT 的密钥，kid 用于轮换时选择密钥
+//
+// HS256/384/512 使用 secret，至少 32 字节，RS256/384/512、ES256/384/512 使用 publicKey (PEM 文件路径或 PEM 内容)
+type AuthKey struct {
+	Kid       string `json:"kid"`
+	Alg       string `json:"alg"`
+	Secret    string `json:"secret"`
+	PublicKey string `json:"publicKey"`
+}
+
+// AuthConf 配置[auth]
+//
+// jwks: JWKS 文件路径，文件变化时重新加载
+// audience: 为空时不校验 aud
+// leeway: 校验 exp/nbf 时允许的时钟偏差秒数
+// rolesClaim: 角色所在的 claim，支持 realm_access.roles 形式，默认 roles
+// allowNoExp: 为 true 时接受没有 exp 的 token，默认拒绝
+type AuthConf struct {
+	Keys       []AuthKey `json:"keys"`
+	Jwks       string    `json:"jwks"`
+	Issuer     string    `json:"issuer"`
+	Audience   string    `json:"audience"`
+	Leeway     int       `json:"leeway"`
+	RolesClaim string    `json:"rolesClaim"`
+	AllowNoExp bool      `json:"allowNoExp"`
+}
+
+// Claims JWT 声明
+type Claims map[string]any
+
+const claimsKey = "lama.claims"
+
+var (
+	ErrTokenMissing = Unauthorized("missing token").WithCode("token_missing")
+	ErrTokenInvalid = Unauthorized("invalid token").WithCode("token_invalid")
+	ErrTokenExpired = Unauthorized("token expired").WithCode("token_expired")
+)
+
+// minHMACKey HS 密钥的最小字节数，与 SHA-256 输出长度相同
+const minHMACKey = 32
+
+type jwtKey struct {
+	kid string
+	alg string
+	key any
+}
+
+type authKeys struct {
+	cfg  AuthConf
+	keys []jwtKey
+}
+
+// Auth 验证 JWT 并将声明放入请求，通过 Ada 提供 *Auth
+//
+//	party.Use(auth.Verify, lama.RequireRoles("admin"))
+type Auth struct {
+	log   Log
+	keys  atomic.Pointer[authKeys]
+	jwks  sync.Mutex
+	stamp string
+	check time.Time
+}
+
+func (s *Auth) Provide() *Auth {
+	return s
+}
+
+func (s *Auth) Init(log Log) error {
+	err := Conf.Define("auth", AuthConf{})
+	if err != nil {
+		return err
+	}
+
+	s.log = log
+	err = s.load()
+	if err != nil {
+		return err
+	}
+
+	Conf.Watch("auth", func(ch *CfgChange) {
+		err := s.load()
+		if err != nil {
+			s.log.Errorf("Auth Reload Failed %v", err)
+		}
+	})
+	return nil
+}
+
+// load 读取配置中的密钥和 JWKS 文件
+func (s *Auth) load() error {
+	var cfg AuthConf
+	if Conf.Exists("auth") {
+		err := Conf.Structure("auth", &cfg)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	if cfg.Jwks != "" && !filepath.IsAbs(cfg.Jwks) {
+		cfg.Jwks = filepath.Join(GetWorkerDir(), cfg.Jwks)
+	}
+
+	ks := &authKeys{cfg: cfg}
+	for _, k := range cfg.Keys {
+		key, err := parseAuthKey(k)
+		if err != nil {
+			return err
+		}
+		ks.keys = append(ks.keys, key)
+	}
+
+	if cfg.Jwks != "" {
+		s.jwks.Lock()
+		s.stamp = fileStamp([]string{cfg.Jwks})
+		s.check = time.Now()
+		s.jwks.Unlock()
+
+		keys, err := loadJwks(cfg.Jwks)
+		if err != nil {
+			return err
+		}
+		ks.keys = append(ks.keys, keys...)
+	}
+
+	s.keys.Store(ks)
+	return nil
+}
+
+// current 返回当前密钥，每秒最多检查一次 JWKS 文件，变化时重新加载，失败时继续使用旧密钥
+func (s *Auth) current() *authKeys {
+	ks := s.keys.Load()
+	if ks.cfg.Jwks == "" {
+		return ks
+	}
+
+	s.jwks.Lock()
+	changed := false
+	if time.Since(s.check) >= time.Second {
+		s.check = time.Now()
+		changed = fileStamp([]string{ks.cfg.Jwks}) != s.stamp
+	}
+	s.jwks.Unlock()
+
+	if changed {
+		err := s.load()
+		if err != nil {
+			s.log.Errorf("JWKS Reload Failed %v", err)
+		} else {
+			s.log.Info("JWKS Reloaded")
+		}
+	}
+	return s.keys.Load()
+}
+
+// Verify 要求请求带有有效的 Bearer token，否则返回 401
+func (s *Auth) Verify(ctx *context.Context) {
+	token := bearerToken(ctx)
+	if token == "" {
+		authError(ctx, ErrTokenMissing)
+		return
+	}
+	claims, err := s.Parse(token)
+	if err != nil {
+		authError(ctx, err)
+		return
+	}
+	SetClaims(ctx, claims)
+	ctx.Next()
+}
+
+// Optional 带有 token 时验证并放入声明，没有 token 时直接放行
+func (s *Auth) Optional(ctx *context.Context) {
+	if bearerToken(ctx) == "" {
+		ctx.Next()
+		return
+	}
+	s.Verify(ctx)
+}
+
+// Parse 验证 token 的签名和 exp/nbf/iss/aud，返回声明，没有 exp 时除非 auth.allowNoExp 否则无效
+func (s *Auth) Parse(token string) (Claims, error) {
+	ks := s.current()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if decodeSegment(parts[0], &header) != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range ks.keys {
+		if header.Kid != "" && k.kid != "" && k.kid != header.Kid {
+			continue
+		}
+		if k.alg != header.Alg {
+			continue
+		}
+		if verifySignature(k, signed, sig) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrTokenInvalid
+	}
+
+	var claims Claims
+	if decodeSegment(parts[1], &claims) != nil {
+		return nil, ErrTokenInvalid
+	}
+	return claims, ks.cfg.validate(claims)
+}
+
+func (s AuthConf) validate(claims Claims) error {
+	now := time.Now().Unix()
+	leeway := int64(s.Leeway)
+
+	exp, ok := claims.number("exp")
+	if !ok && !s.AllowNoExp {
+		return ErrTokenInvalid
+	}
+	if ok && now > exp+leeway {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.number("nbf"); ok && now+leeway < nbf {
+		return ErrTokenInvalid
+	}
+	if s.Issuer != "" && claims.String("iss") != s.Issuer {
+		return ErrTokenInvalid
+	}
+	if s.Audience != "" && !hasString(claims.Strings("aud"), s.Audience) {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+func bearerToken(ctx *context.Context) string {
+	h := ctx.GetHeader("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+func authError(ctx *context.Context, err error) {
+	if err == ErrTokenMissing {
+		ctx.Header("WWW-Authenticate", "Bearer")
+	} else if e, ok := AsError(err); ok && e.Status == 401 {
+		ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	renderError(ctx, err, false, nil)
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"256": crypto.SHA256,
+	"384": crypto.SHA384,
+	"512": crypto.SHA512,
+}
+
+func verifySignature(k jwtKey, signed, sig []byte) bool {
+	if len(k.alg) != 5 {
+		return false
+	}
+	hash, ok := jwtHashes[k.alg[2:]]
+	if !ok {
+		return false
+	}
+	h := hash.New()
+	h.Write(signed)
+	sum := h.Sum(nil)
+
+	// alg 必须与密钥类型一致，避免用公钥作为 HS 密钥等混淆
+	switch key := k.key.(type) {
+	case []byte:
+		if k.alg[:2] != "HS" {
+			return false
+		}
+		mac := hmac.New(hash.New, key)
+		mac.Write(signed)
+		return hmac.Equal(sig, mac.Sum(nil))
+
+	case *rsa.PublicKey:
+		if k.alg[:2] != "RS" {
+			return false
+		}
+		return rsa.VerifyPKCS1v15(key, hash, sum, sig) == nil
+
+	case *ecdsa.PublicKey:
+		if k.alg[:2] != "ES" {
+			return false
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		ss := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(key, sum, r, ss)
+	}
+	return false
+}
+
+// parseAuthKey 解析配置中的密钥
+func parseAuthKey(k AuthKey) (jwtKey, error) {
+	key := jwtKey{kid: k.Kid, alg: k.Alg}
+	switch {
+	case strings.HasPrefix(k.Alg, "HS"):
+		if len(k.Secret) < minHMACKey {
+			return key, fmt.Errorf("auth: key %s secret must be at least %d bytes", k.Kid, minHMACKey)
+		}
+		key.key = []byte(k.Secret)
+
+	case strings.HasPrefix(k.Alg, "RS"), strings.HasPrefix(k.Alg, "ES"):
+		data := []byte(k.PublicKey)
+		if !strings.HasPrefix(k.PublicKey, "-----BEGIN") {
+			path := k.PublicKey
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(GetWorkerDir(), path)
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return key, err
+			}
+			data = b
+		}
+		pub, err := parsePublicKey(data)
+		if err != nil {
+			return key, fmt.Errorf("auth: key %s: %w", k.Kid, err)
+		}
+		if _, ok := pub.(*rsa.PublicKey); ok != (k.Alg[0] == 'R') {
+			return key, fmt.Errorf("auth: key %s does not match alg %s", k.Kid, k.Alg)
+		}
+		key.key = pub
+
+	default:
+		return key, fmt.Errorf("auth: unsupported alg %s", k.Alg)
+	}
+	return key, nil
+}
+
+func parsePublicKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unsupported public key %T", pub)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var jwkCurves = map[string]struct {
+	curve elliptic.Curve
+	alg   string
+}{
+	"P-256": {elliptic.P256(), "ES256"},
+	"P-384": {elliptic.P384(), "ES384"},
+	"P-521": {elliptic.P521(), "ES512"},
+}
+
+// loadJwks 读取 JWKS 文件，跳过 use 不是 sig 的密钥
+func loadJwks(path string) ([]jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err = json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %s: %w", path, err)
+	}
+
+	var keys []jwtKey
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("auth: %s: key %s: %w", path, k.Kid, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s jwk) parse() (jwtKey, error) {
+	key := jwtKey{kid: s.Kid, alg: s.Alg}
+	b64 := base64.RawURLEncoding
+
+	switch s.Kty {
+	case "oct":
+		k, err := b64.DecodeString(s.K)
+		if err != nil {
+			return key, err
+		}
+		if len(k) < minHMACKey {
+			return key, fmt.Errorf("oct key must be at least %d bytes", minHMACKey)
+		}
+		if key.alg == "" {
+			key.alg = "HS256"
+		}
+		key.key = k
+
+	case "RSA":
+		n, err := b64.DecodeString(s.N)
+		if err != nil {
+			return key, err
+		}
+		e, err := b64.DecodeString(s.E)
+		if err != nil {
+			return key, err
+		}
+		if key.alg == "" {
+			key.alg = "RS256"
+		}
+		key.key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+	case "EC":
+		c, ok := jwkCurves[s.Crv]
+		if !ok {
+			return key, fmt.Errorf("unsupported curve %s", s.Crv)
+		}
+		x, err := b64.DecodeString(s.X)
+		if err != nil {
+			return key, err
+		}
+		y, err := b64.DecodeString(s.Y)
+		if err != nil {
+			return key, err
+		}
+		if key.alg == "" {
+			key.alg = c.alg
+		}
+		key.key = &ecdsa.PublicKey{Curve: c.curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+
+	default:
+		return key, fmt.Errorf("unsupported kty %s", s.Kty)
+	}
+	return key, nil
+}
+
+// SetClaims 将声明放入请求，sub 作为用户标识用于日志和限流
+func SetClaims(ctx *context.Context, claims Claims) {
+	ctx.Values().Set(claimsKey, claims)
+	if sub := claims.Subject(); sub != "" {
+		ctx.Values().Set(userIDKey, sub)
+		ctx.SetUser(&context.SimpleUser{
+			Authorization: "Bearer",
+			AuthorizedAt:  time.Now(),
+			ID:            sub,
+			Username:      claims.String("preferred_username"),
+			Email:         claims.String("email"),
+			Roles:         claims.Roles(),
+		})
+	}
+}
+
+// ClaimsFrom 返回请求中的声明，未认证时为 nil
+func ClaimsFrom(ctx *context.Context) Claims {
+	claims, _ := ctx.Values().Get(claimsKey).(Claims)
+	return claims
+}
+
+func (s Claims) String(key string) string {
+	v, _ := s.lookup(key).(string)
+	return v
+}
+
+// Strings 返回字符串数组，单个字符串按空格分割，如 scope
+func (s Claims) Strings(key string) []string {
+	switch v := s.lookup(key).(type) {
+	case string:
+		return strings.Fields(v)
+	case []string:
+		return v
+	case []any:
+		var list []string
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func (s Claims) Subject() string {
+	return s.String("sub")
+}
+
+// Roles 返回 auth.rolesClaim 指定的角色
+func (s Claims) Roles() []string {
+	return s.Strings(Conf.String("auth.rolesClaim", "roles"))
+}
+
+// Scopes 返回 scope 或 scp 中的权限范围
+func (s Claims) Scopes() []string {
+	if scopes := s.Strings("scope"); scopes != nil {
+		return scopes
+	}
+	return s.Strings("scp")
+}
+
+func (s Claims) number(key string) (int64, bool) {
+	v, ok := s[key].(float64)
+	return int64(v), ok
+}
+
+// lookup 按 . 分隔的路径取值
+func (s Claims) lookup(key string) any {
+	var v any = map[string]any(s)
+	for _, k := range strings.Split(key, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+// RequireRoles 要求拥有任一角色，未认证返回 401，缺少角色返回 403
+//
+//	party.Use(auth.Verify, lama.RequireRoles("admin"))
+func RequireRoles(roles ...string) context.Handler {
+	return func(ctx *context.Context) {
+		claims := ClaimsFrom(ctx)
+		if claims == nil {
+			authError(ctx, ErrTokenMissing)
+			return
+		}
+		have := claims.Roles()
+		for _, r := range roles {
+			if hasString(have, r) {
+				ctx.Next()
+				return
+			}
+		}
+		renderError(ctx, Forbidden("").WithCode("insufficient_role"), false, nil)
+	}
+}
+
+// RequireScopes 要求拥有全部权限范围，未认证返回 401，缺少时返回 403
+func RequireScopes(scopes ...string) context.Handler {
+	return func(ctx *context.Context) {
+		claims := ClaimsFrom(ctx)
+		if claims == nil {
+			authError(ctx, ErrTokenMissing)
+			return
+		}
+		have := claims.Scopes()
+		for _, sc := range scopes {
+			if !hasString(have, sc) {
+				renderError(ctx, Forbidden("").WithCode("insufficient_scope").WithDetails(Fields{"scope": sc}), false, nil)
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,155 @@
+package lama
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testToken 按 alg 签发 token，key 为 HS 密钥或 RSA 私钥
+func testToken(t *testing.T, alg string, key any, claims Claims) string {
+	t.Helper()
+	seg := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	signed := seg(map[string]string{"alg": alg, "typ": "JWT"}) + "." + seg(claims)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256([]byte(signed))
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testAuth(t *testing.T, values map[string]any) (*Auth, error) {
+	t.Helper()
+	testConf(t, values)
+	s := &Auth{log: Print}
+	return s, s.load()
+}
+
+func TestAuthParse(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	s, err := testAuth(t, map[string]any{
+		"auth.keys": []any{
+			map[string]any{"kid": "hs", "alg": "HS256", "secret": testSecret},
+			map[string]any{"kid": "rs", "alg": "RS256", "publicKey": string(pub)},
+		},
+		"auth.issuer": "lama",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	valid := Claims{"sub": "u1", "iss": "lama", "exp": now + 60}
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"hs256", testToken(t, "HS256", []byte(testSecret), valid), nil},
+		{"rs256", testToken(t, "RS256", priv, valid), nil},
+		{"wrong secret", testToken(t, "HS256", []byte(testSecret+"x"), valid), ErrTokenInvalid},
+		{"alg none", testToken(t, "none", nil, valid), ErrTokenInvalid},
+		{"rs public key as hs secret", testToken(t, "HS256", pub, valid), ErrTokenInvalid},
+		{"expired", testToken(t, "HS256", []byte(testSecret), Claims{"sub": "u1", "iss": "lama", "exp": now - 60}), ErrTokenExpired},
+		{"no exp", testToken(t, "HS256", []byte(testSecret), Claims{"sub": "u1", "iss": "lama"}), ErrTokenInvalid},
+		{"not before", testToken(t, "HS256", []byte(testSecret), Claims{"iss": "lama", "exp": now + 60, "nbf": now + 60}), ErrTokenInvalid},
+		{"issuer", testToken(t, "HS256", []byte(testSecret), Claims{"iss": "other", "exp": now + 60}), ErrTokenInvalid},
+		{"malformed", "a.b", ErrTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.Parse(tt.token)
+			if err != tt.err {
+				t.Fatalf("Parse() err = %v, want %v", err, tt.err)
+			}
+			if err == nil && claims.Subject() != "u1" {
+				t.Errorf("sub = %q, want u1", claims.Subject())
+			}
+		})
+	}
+}
+
+func TestAuthAllowNoExp(t *testing.T) {
+	s, err := testAuth(t, map[string]any{
+		"auth.keys":       []any{map[string]any{"alg": "HS256", "secret": testSecret}},
+		"auth.allowNoExp": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Parse(testToken(t, "HS256", []byte(testSecret), Claims{"sub": "u1"}))
+	if err != nil {
+		t.Fatalf("Parse() err = %v, want nil", err)
+	}
+}
+
+func TestAuthLoad(t *testing.T) {
+	jwks := func(k string) string {
+		path := filepath.Join(t.TempDir(), "jwks.json")
+		data := `{"keys":[{"kty":"oct","kid":"a","k":"` + base64.RawURLEncoding.EncodeToString([]byte(k)) + `"}]}`
+		err := os.WriteFile(path, []byte(data), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name   string
+		values map[string]any
+		ok     bool
+	}{
+		{"secret", map[string]any{"auth.keys": []any{map[string]any{"alg": "HS256", "secret": testSecret}}}, true},
+		{"short secret", map[string]any{"auth.keys": []any{map[string]any{"alg": "HS256", "secret": "secret"}}}, false},
+		{"unsupported alg", map[string]any{"auth.keys": []any{map[string]any{"alg": "none", "secret": testSecret}}}, false},
+		{"jwks oct", map[string]any{"auth.jwks": jwks(testSecret)}, true},
+		{"jwks short oct", map[string]any{"auth.jwks": jwks("secret")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testAuth(t, tt.values)
+			if (err == nil) != tt.ok {
+				t.Fatalf("load() err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
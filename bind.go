@@ -0,0 +1,105 @@
+package lama
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gookit/validate"
+	"github.com/gookit/validate/locales/ruru"
+	"github.com/gookit/validate/locales/zhcn"
+	"github.com/gookit/validate/locales/zhtw"
+	"github.com/iris-contrib/schema"
+	"github.com/kataras/iris/v12/context"
+)
+
+var (
+	localeMu sync.RWMutex
+	locales  = map[string]map[string]string{
+		"zh-cn": zhcn.Data,
+		"zh-tw": zhtw.Data,
+		"ru-ru": ruru.Data,
+	}
+)
+
+// RegisterLocale 注册校验消息的语言，lang 如 zh-CN
+func RegisterLocale(lang string, messages map[string]string) {
+	localeMu.Lock()
+	defer localeMu.Unlock()
+	locales[strings.ToLower(lang)] = messages
+}
+
+// Bind 读取查询参数、请求体 (JSON/表单) 和路径参数到 T，按 scene 校验
+//
+// 绑定失败 panic 400，校验失败 panic 422，details 为全部字段错误，消息按 Accept-Language 翻译。
+// 字段标签: url 查询参数、json/form 请求体、param 路径参数、validate 校验规则
+func Bind[T any](ctx *context.Context, scene ...string) T {
+	var v T
+
+	err := ctx.ReadQuery(&v)
+	if err == nil && ctx.Request().ContentLength != 0 {
+		ct := ctx.GetContentTypeRequested()
+		switch {
+		case strings.HasPrefix(ct, context.ContentJSONHeaderValue):
+			err = ctx.ReadJSON(&v)
+		case strings.HasPrefix(ct, context.ContentFormHeaderValue),
+			strings.HasPrefix(ct, context.ContentFormMultipartHeaderValue):
+			err = readPostForm(ctx, &v)
+		default:
+			err = ctx.ReadBody(&v)
+		}
+	}
+	if err == nil {
+		err = ctx.ReadParams(&v)
+	}
+	if err != nil && !context.IsErrEmptyJSON(err) {
+		panic(BadRequest("").WithCode("bind_failed").Wrap(err))
+	}
+
+	val := validate.Struct(&v)
+	val.StopOnError = false
+	if msgs := localeMessages(ctx.GetHeader("Accept-Language")); msgs != nil {
+		val.AddMessages(msgs)
+	}
+	if !val.Validate(scene...) {
+		fe := fieldErrors(val.Errors)
+		panic(Unprocessable(fe[0].Msg).WithCode("validation_failed").WithDetails(fe))
+	}
+	return v
+}
+
+// readPostForm 只读取请求体中的表单，ReadForm 会混入查询参数覆盖请求体
+func readPostForm(ctx *context.Context, v any) error {
+	ctx.FormValues()
+	values := ctx.Request().PostForm
+	if len(values) == 0 {
+		return nil
+	}
+	return schema.DecodeForm(values, v)
+}
+
+// localeMessages 按 Accept-Language 选择校验消息，无匹配时使用默认英文
+func localeMessages(accept string) map[string]string {
+	localeMu.RLock()
+	defer localeMu.RUnlock()
+
+	for _, part := range strings.Split(accept, ",") {
+		lang := strings.ToLower(strings.TrimSpace(strings.Split(part, ";")[0]))
+		if lang == "" {
+			continue
+		}
+		if msgs, ok := locales[lang]; ok {
+			return msgs
+		}
+		// 只有语言时按名称取第一个地区，zh 使用 zh-cn
+		var match string
+		for key := range locales {
+			if strings.HasPrefix(key, lang+"-") && (match == "" || key < match) {
+				match = key
+			}
+		}
+		if match != "" {
+			return locales[match]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package lama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gookit/validate"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type bindUser struct {
+	ID    int    `url:"id" json:"id" form:"id" param:"id"`
+	Name  string `url:"name" json:"name" form:"name" validate:"required"`
+	Email string `url:"email" json:"email" form:"email" validate:"required|email"`
+	Age   int    `url:"age" json:"age" form:"age" validate:"min:18"`
+}
+
+func (s bindUser) ConfigValidation(v *validate.Validation) {
+	v.WithScenes(validate.SValues{
+		"rename": {"Name"},
+	})
+}
+
+// testBind 在 /users/{id} 上调用 Bind，返回绑定结果或 panic 的 *Error
+func testBind(t *testing.T, req *http.Request, scene ...string) (bindUser, *Error) {
+	t.Helper()
+	var user bindUser
+	var bindErr *Error
+
+	app := iris.New()
+	app.Logger().SetLevel("disable")
+	app.Any("/users/{id:int}", func(ctx *context.Context) {
+		defer func() {
+			if v := recover(); v != nil {
+				bindErr = v.(*Error)
+			}
+		}()
+		user = Bind[bindUser](ctx, scene...)
+	})
+	err := app.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.ServeHTTP(httptest.NewRecorder(), req)
+	return user, bindErr
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		ct    string
+		body  string
+		want  bindUser
+	}{
+		{"query", "name=q&email=q@a.com&age=20", "", "", bindUser{ID: 3, Name: "q", Email: "q@a.com", Age: 20}},
+		{"json over query", "name=q&age=20", context.ContentJSONHeaderValue, `{"name":"j","email":"j@a.com"}`, bindUser{ID: 3, Name: "j", Email: "j@a.com", Age: 20}},
+		{"form over query", "name=q&age=20", context.ContentFormHeaderValue, "name=f&email=f@a.com", bindUser{ID: 3, Name: "f", Email: "f@a.com", Age: 20}},
+		{"params over body", "id=1", context.ContentJSONHeaderValue, `{"id":2,"name":"j","email":"j@a.com","age":30}`, bindUser{ID: 3, Name: "j", Email: "j@a.com", Age: 30}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/3?"+tt.query, strings.NewReader(tt.body))
+			if tt.ct != "" {
+				req.Header.Set("Content-Type", tt.ct)
+			}
+			got, err := testBind(t, req)
+			if err != nil {
+				t.Fatalf("Bind() err = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Bind() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		ct     string
+		body   string
+		lang   string
+		scene  []string
+		status int
+		fields []string
+		msg    string
+	}{
+		{"bad json", "", context.ContentJSONHeaderValue, `{"name":`, "", nil, 400, nil, ""},
+		{"all field errors", "age=10", "", "", "", nil, 422, []string{"age", "email", "name"}, ""},
+		{"scene", "", "", "", "", []string{"rename"}, 422, []string{"name"}, ""},
+		{"scene ok", "name=n", "", "", "", []string{"rename"}, 0, nil, ""},
+		{"locale", "", "", "", "fr-FR;q=0.9, zh-CN", []string{"rename"}, 422, []string{"name"}, "是必填项"},
+		{"locale prefix", "", "", "", "zh", []string{"rename"}, 422, []string{"name"}, "是必填项"},
+		{"unknown locale", "", "", "", "fr", []string{"rename"}, 422, []string{"name"}, "is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/3?"+tt.query, strings.NewReader(tt.body))
+			if tt.ct != "" {
+				req.Header.Set("Content-Type", tt.ct)
+			}
+			if tt.lang != "" {
+				req.Header.Set("Accept-Language", tt.lang)
+			}
+			_, err := testBind(t, req, tt.scene...)
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("Bind() err = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Status != tt.status {
+				t.Fatalf("Bind() err = %v, want status %d", err, tt.status)
+			}
+			if tt.fields == nil {
+				return
+			}
+
+			fe, _ := err.Details.([]FieldError)
+			var fields []string
+			for _, e := range fe {
+				fields = append(fields, e.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.fields)
+			}
+			if tt.msg != "" && !strings.Contains(err.Msg, tt.msg) {
+				t.Errorf("msg = %q, want to contain %q", err.Msg, tt.msg)
+			}
+		})
+	}
+}
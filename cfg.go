@@ -0,0 +1,386 @@
+package lama
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gookit "github.com/gookit/config/v2"
+	"github.com/gookit/config/v2/toml"
+	"github.com/spf13/cast"
+)
+
+type CheckFn func(c Cfg) error
+type WatchFn func(ch *CfgChange)
+
+// Config 在 gookit 配置之上提供重载、校验与按键订阅
+type Config struct {
+	*gookit.Config
+	mu     sync.Mutex
+	wmu    sync.RWMutex
+	dmu    sync.RWMutex
+	files  []string
+	defs   map[string]reflect.Type
+	file   map[string]any
+	layers []*cfgLayer
+	checks []CheckFn
+	errs   []error
+	watch  map[string][]WatchFn
+}
+
+func newConfig(c *gookit.Config) *Config {
+	c.AddDriver(toml.Driver)
+	c.WithOptions(func(opt *gookit.Options) {
+		opt.DecoderConfig.TagName = "json"
+	})
+	return &Config{
+		Config: c,
+		watch:  make(map[string][]WatchFn),
+	}
+}
+
+// Load 加载配置文件，记录文件以便重载和监听
+func (s *Config) Load(files ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dmu.Lock()
+	s.files = append(s.files, files...)
+	s.dmu.Unlock()
+
+	err := s.Config.LoadFiles(files...)
+	s.file = s.Data()
+	return err
+}
+
+// Files 返回已加载的配置文件
+func (s *Config) Files() []string {
+	s.dmu.RLock()
+	defer s.dmu.RUnlock()
+	return append([]string{}, s.files...)
+}
+
+// Check 注册配置校验，重载时校验失败将保留旧配置
+func (s *Config) Check(fn CheckFn) {
+	s.mu.Lock()
+	s.checks = append(s.checks, fn)
+	s.mu.Unlock()
+}
+
+// Watch 订阅指定键的变化，key 为空时订阅全部配置
+func (s *Config) Watch(key string, fn WatchFn) {
+	s.wmu.Lock()
+	s.watch[key] = append(s.watch[key], fn)
+	s.wmu.Unlock()
+}
+
+// Reload 重新读取配置文件，校验通过后发布变化
+func (s *Config) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := s.Files()
+	if len(files) == 0 {
+		return nil
+	}
+
+	next := newConfig(gookit.New(s.Name()))
+	err := next.LoadFiles(files...)
+	if err != nil {
+		return err
+	}
+
+	// 校验失败时保留旧的文件配置
+	old := s.file
+	s.file = next.Data()
+	err = s.apply()
+	if err != nil {
+		s.file = old
+	}
+	return err
+}
+
+func (s *Config) apply() error {
+	data := s.merge()
+
+	next := newConfig(gookit.New(s.Name()))
+	next.SetData(data)
+	for _, fn := range s.checks {
+		err := fn(next)
+		if err != nil {
+			return err
+		}
+	}
+
+	old := s.Data()
+	s.SetData(data)
+	s.publish(old, data)
+	return nil
+}
+
+// Overlay 设置名为 name 的配置层，覆盖在文件配置之上，values 为按路径的键值
+func (s *Config) Overlay(name string, values map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var layer *cfgLayer
+	for _, l := range s.layers {
+		if l.name == name {
+			layer = l
+		}
+	}
+
+	if layer == nil {
+		layer = &cfgLayer{name: name}
+		s.layers = append(s.layers, layer)
+	}
+
+	old := layer.values
+	layer.values = values
+	err := s.apply()
+	if err != nil {
+		layer.values = old
+	}
+	return err
+}
+
+func (s *Config) merge() map[string]any {
+	data := copyMap(s.file)
+	for _, l := range s.layers {
+		for _, key := range sortedKeys(l.values) {
+			setPath(data, key, l.values[key])
+		}
+	}
+	return data
+}
+
+func (s *Config) publish(old, data map[string]any) {
+	changes := diffMap(old, data)
+	if len(changes) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(changes))
+	for _, ch := range changes {
+		keys = append(keys, ch.Key)
+	}
+	Print.Infof("Config Changed %s", strings.Join(keys, ","))
+
+	s.wmu.RLock()
+	watch := make(map[string][]WatchFn, len(s.watch))
+	for k, v := range s.watch {
+		watch[k] = v
+	}
+	s.wmu.RUnlock()
+
+	for key, fns := range watch {
+		ch := &CfgChange{Key: key, Old: lookup(old, key), New: lookup(data, key)}
+		if key != "" && reflect.DeepEqual(ch.Old, ch.New) {
+			continue
+		}
+		for _, fn := range fns {
+			if key == "" {
+				for _, c := range changes {
+					fn(c)
+				}
+			} else {
+				fn(ch)
+			}
+		}
+	}
+}
+
+type cfgLayer struct {
+	name   string
+	values map[string]any
+}
+
+// CfgChange 配置变化
+type CfgChange struct {
+	Key string
+	Old any
+	New any
+}
+
+func (s *CfgChange) String() string {
+	return cast.ToString(s.New)
+}
+
+func (s *CfgChange) Int() int64 {
+	return cast.ToInt64(s.New)
+}
+
+func (s *CfgChange) Float() float64 {
+	return cast.ToFloat64(s.New)
+}
+
+func (s *CfgChange) Bool() bool {
+	return cast.ToBool(s.New)
+}
+
+func (s *CfgChange) Deleted() bool {
+	return s.New == nil
+}
+
+// CfgWatch 轮询监听配置文件，通过 app.watch 开启
+type CfgWatch struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+func (s *CfgWatch) Serve() chan error {
+	errCh := make(chan error)
+	if !Conf.Bool("app.watch") {
+		close(errCh)
+		return errCh
+	}
+
+	interval := time.Duration(Conf.Int("app.watchInterval", 2)) * time.Second
+	debounce := time.Duration(Conf.Int("app.watchDebounce", 500)) * time.Millisecond
+	files := Conf.Files()
+	stop := make(chan struct{})
+	s.stop = stop
+
+	go func() {
+		defer close(errCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		stamp := fileStamp(files)
+		var changed time.Time
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				cur := fileStamp(files)
+				if cur != stamp {
+					stamp = cur
+					changed = time.Now()
+					continue
+				}
+				if changed.IsZero() || time.Since(changed) < debounce {
+					continue
+				}
+				changed = time.Time{}
+				err := Conf.Reload()
+				if err != nil {
+					Print.Errorf("Config Reload Failed %v", err)
+				}
+			}
+		}
+	}()
+
+	Print.Infof("Config Watching %s", strings.Join(files, ","))
+	return errCh
+}
+
+func (s *CfgWatch) Stop() error {
+	s.once.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+	return nil
+}
+
+func fileStamp(files []string) string {
+	var stamp string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			stamp += file + ":-;"
+			continue
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp
+}
+
+func lookup(data map[string]any, key string) any {
+	if key == "" {
+		return data
+	}
+
+	var cur any = data
+	for _, k := range strings.Split(key, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur, ok = m[k]
+		if !ok {
+			return nil
+		}
+	}
+	return cur
+}
+
+func setPath(data map[string]any, key string, val any) {
+	keys := strings.Split(key, ".")
+	for _, k := range keys[:len(keys)-1] {
+		m, ok := data[k].(map[string]any)
+		if !ok {
+			m = make(map[string]any)
+			data[k] = m
+		}
+		data = m
+	}
+	data[keys[len(keys)-1]] = val
+}
+
+func flatMap(prefix string, data map[string]any, out map[string]any) {
+	for k, v := range data {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if m, ok := v.(map[string]any); ok && len(m) > 0 {
+			flatMap(key, m, out)
+		} else {
+			out[key] = v
+		}
+	}
+}
+
+func diffMap(old, data map[string]any) []*CfgChange {
+	a := make(map[string]any)
+	b := make(map[string]any)
+	flatMap("", old, a)
+	flatMap("", data, b)
+
+	var changes []*CfgChange
+	for k, v := range a {
+		nv, ok := b[k]
+		if !ok || !reflect.DeepEqual(v, nv) {
+			changes = append(changes, &CfgChange{Key: k, Old: v, New: nv})
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			changes = append(changes, &CfgChange{Key: k, New: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+func copyMap(data map[string]any) map[string]any {
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		if m, ok := v.(map[string]any); ok {
+			out[k] = copyMap(m)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package lama
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Command 命令行子命令，服务在 Init 中注册，服务初始化后代替 Serve 执行
+//
+//	./app cmd apikey create -name partner
+//	./app cmd help
+type Command struct {
+	Name  string
+	Usage string
+	Run   func(args []string) error
+}
+
+var commands = map[string]Command{}
+
+// RegisterCommand 注册子命令
+func RegisterCommand(c Command) {
+	commands[c.Name] = c
+}
+
+// commandPrefix 子命令的前缀参数，其它参数留给应用自己解析
+const commandPrefix = "cmd"
+
+// runCommand 执行 os.Args[2] 对应的子命令，os.Args[1] 不是 cmd 时返回 false
+func runCommand(app *Ada) bool {
+	if len(os.Args) < 2 || os.Args[1] != commandPrefix {
+		return false
+	}
+	if len(os.Args) < 3 || os.Args[2] == "help" {
+		printCommands()
+		app.Stop()
+		return true
+	}
+
+	err := fmt.Errorf("unknown command %s, run with cmd help to list commands", os.Args[2])
+	if c, ok := commands[os.Args[2]]; ok {
+		err = c.Run(os.Args[3:])
+	}
+	app.Stop()
+	if err != nil {
+		Print.Fatal(err)
+	}
+	return true
+}
+
+func printCommands() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-12s %s\n", name, commands[name].Usage)
+	}
+}
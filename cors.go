@@ -0,0 +1,237 @@
+package lama
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+// CorsPolicy 跨域策略
+//
+// origins: 允许的来源，* 为全部，*.example.com 或 https://*.example.com 匹配子域名
+// maxAge: 预检结果缓存秒数
+type CorsPolicy struct {
+	Origins       []string `json:"origins"`
+	Methods       []string `json:"methods"`
+	Headers       []string `json:"headers"`
+	ExposeHeaders []string `json:"exposeHeaders"`
+	Credentials   bool     `json:"credentials"`
+	MaxAge        int      `json:"maxAge"`
+}
+
+// CorsConf 配置[cors]，parties 按路径前缀覆盖策略，如 [cors.parties."/partner"]
+//
+// 没有[cors]或 origins 为空时不允许跨域，origins 含 * 时不能开启 credentials
+type CorsConf struct {
+	CorsPolicy `json:",squash"`
+	Parties    map[string]CorsPolicy `json:"parties"`
+}
+
+var defaultCorsMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+type corsRules struct {
+	def     CorsPolicy
+	parties []string
+	policy  map[string]CorsPolicy
+}
+
+// newCors 按配置[cors]创建跨域中间件，配置变化时重新加载
+func newCors() context.Handler {
+	err := Conf.Define("cors", CorsConf{})
+	if err != nil {
+		panic(err)
+	}
+
+	var rules atomic.Pointer[corsRules]
+	load := func() error {
+		r, err := loadCors()
+		if err == nil {
+			rules.Store(r)
+		}
+		return err
+	}
+	err = load()
+	if err != nil {
+		panic(err)
+	}
+
+	Conf.Watch("cors", func(ch *CfgChange) {
+		err := load()
+		if err != nil {
+			Print.Errorf("Cors Reload Failed %v", err)
+		}
+	})
+
+	return func(ctx *context.Context) {
+		rules.Load().handle(ctx)
+	}
+}
+
+// check 拒绝 origins 为 * 且允许凭证的策略，否则任何站点都能携带凭证跨域访问
+func (s CorsPolicy) check(party string) error {
+	if s.Credentials && hasString(s.Origins, "*") {
+		if party != "" {
+			return fmt.Errorf("cors.parties.%q: credentials cannot be used with origins *", party)
+		}
+		return errors.New("cors: credentials cannot be used with origins *")
+	}
+	return nil
+}
+
+func loadCors() (*corsRules, error) {
+	cfg := CorsConf{}
+	if Conf.Exists("cors") {
+		err := Conf.Structure("cors", &cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := cfg.check("")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &corsRules{def: cfg.CorsPolicy, policy: cfg.Parties}
+	for prefix, p := range cfg.Parties {
+		err = p.check(prefix)
+		if err != nil {
+			return nil, err
+		}
+		r.parties = append(r.parties, prefix)
+	}
+	// 最长前缀优先
+	sort.Slice(r.parties, func(i, j int) bool {
+		return len(r.parties[i]) > len(r.parties[j])
+	})
+	return r, nil
+}
+
+// Cors 返回按策略处理跨域的中间件，用于路由组或路由
+//
+//	party.AllowMethods(iris.MethodOptions)
+//	party.Use(lama.Cors(lama.CorsPolicy{Origins: []string{"https://a.com"}}))
+//
+// 预检请求需要路由组允许 OPTIONS；全局[cors]未配置 origins 时不拦截，由这里处理
+func Cors(p CorsPolicy) context.Handler {
+	err := p.check("")
+	if err != nil {
+		panic(err)
+	}
+	r := &corsRules{def: p}
+	return r.handle
+}
+
+// hasPathPrefix 按路径段匹配前缀，/api 匹配 /api 和 /api/x，不匹配 /apix
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+func (s *corsRules) match(path string) CorsPolicy {
+	for _, prefix := range s.parties {
+		if hasPathPrefix(path, prefix) {
+			return s.policy[prefix]
+		}
+	}
+	return s.def
+}
+
+func (s *corsRules) handle(ctx *context.Context) {
+	origin := ctx.GetHeader("Origin")
+	if origin == "" {
+		ctx.Next()
+		return
+	}
+
+	p := s.match(ctx.Path())
+	// 未配置来源时不处理，交给路由上的 Cors
+	if len(p.Origins) == 0 {
+		ctx.Next()
+		return
+	}
+	preflight := ctx.Method() == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != ""
+
+	ctx.ResponseWriter().Header().Add("Vary", "Origin")
+	if !p.allowOrigin(origin) {
+		if preflight {
+			ctx.StopWithStatus(http.StatusForbidden)
+			return
+		}
+		ctx.Next()
+		return
+	}
+
+	// origins 为 * 时不会允许凭证，见 check
+	if hasString(p.Origins, "*") {
+		ctx.Header("Access-Control-Allow-Origin", "*")
+	} else {
+		ctx.Header("Access-Control-Allow-Origin", origin)
+	}
+	if p.Credentials {
+		ctx.Header("Access-Control-Allow-Credentials", "true")
+	}
+	if len(p.ExposeHeaders) > 0 {
+		ctx.Header("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+	}
+
+	if !preflight {
+		ctx.Next()
+		return
+	}
+
+	methods := p.Methods
+	if len(methods) == 0 {
+		methods = defaultCorsMethods
+	}
+	ctx.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if len(p.Headers) > 0 {
+		ctx.Header("Access-Control-Allow-Headers", strings.Join(p.Headers, ", "))
+	} else if h := ctx.GetHeader("Access-Control-Request-Headers"); h != "" {
+		ctx.Header("Access-Control-Allow-Headers", h)
+	}
+	if p.MaxAge > 0 {
+		ctx.Header("Access-Control-Max-Age", strconv.Itoa(p.MaxAge))
+	}
+	ctx.StopWithStatus(http.StatusNoContent)
+}
+
+func (s CorsPolicy) allowOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, o := range s.Origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+
+		pattern := o
+		scheme := ""
+		if i := strings.Index(o, "://"); i >= 0 {
+			scheme, pattern = o[:i], o[i+3:]
+		}
+		if scheme != "" && !strings.EqualFold(scheme, u.Scheme) {
+			continue
+		}
+		if strings.HasPrefix(pattern, "*.") {
+			if strings.HasSuffix(strings.ToLower(u.Hostname()), strings.ToLower(pattern[1:])) {
+				return true
+			}
+		} else if scheme == "" && strings.EqualFold(pattern, u.Host) {
+			return true
+		}
+	}
+	return false
+}
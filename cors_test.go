@@ -0,0 +1,132 @@
+package lama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestLoadCors(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		ok     bool
+	}{
+		{"default", nil, true},
+		{"origins", map[string]any{"cors.origins": []any{"https://a.com"}, "cors.credentials": true}, true},
+		{"any credentials", map[string]any{"cors.origins": []any{"*"}, "cors.credentials": true}, false},
+		{"party any credentials", map[string]any{
+			"cors.origins":                  []any{"https://a.com"},
+			"cors.parties./api.origins":     []any{"https://b.com", "*"},
+			"cors.parties./api.credentials": true,
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConf(t, tt.values)
+			_, err := loadCors()
+			if (err == nil) != tt.ok {
+				t.Fatalf("loadCors() err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCorsHandle(t *testing.T) {
+	rules := &corsRules{
+		def: CorsPolicy{Origins: []string{"*"}},
+		policy: map[string]CorsPolicy{
+			"/partner": {Origins: []string{"https://*.a.com"}, Credentials: true},
+		},
+		parties: []string{"/partner"},
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		origin      string
+		status      int
+		allowOrigin string
+		credentials string
+	}{
+		{"any", http.MethodGet, "/", "https://evil.com", 200, "*", ""},
+		{"party root", http.MethodGet, "/partner", "https://x.a.com", 200, "https://x.a.com", "true"},
+		{"party boundary", http.MethodGet, "/partnerx", "https://x.a.com", 200, "*", ""},
+		{"party allowed", http.MethodGet, "/partner/x", "https://x.a.com", 200, "https://x.a.com", "true"},
+		{"party denied", http.MethodGet, "/partner/x", "https://evil.com", 200, "", ""},
+		{"party preflight denied", http.MethodOptions, "/partner/x", "https://evil.com", 403, "", ""},
+		{"party preflight", http.MethodOptions, "/partner/x", "https://x.a.com", 204, "https://x.a.com", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			vary := func(ctx *context.Context) {
+				ctx.Header("Vary", "Accept-Encoding")
+				ctx.Next()
+			}
+			rec := testServe(req, vary, rules.handle)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if v := rec.Header().Get("Access-Control-Allow-Origin"); v != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", v, tt.allowOrigin)
+			}
+			if v := rec.Header().Get("Access-Control-Allow-Credentials"); v != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", v, tt.credentials)
+			}
+			if v := rec.Header().Values("Vary"); len(v) != 2 || v[1] != "Origin" {
+				t.Errorf("Vary = %q, want Accept-Encoding and Origin", v)
+			}
+		})
+	}
+}
+
+func TestCorsDefault(t *testing.T) {
+	testConf(t, nil)
+	rules, err := loadCors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := Cors(CorsPolicy{Origins: []string{"https://a.com"}})
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		handlers    []context.Handler
+		status      int
+		allowOrigin string
+	}{
+		{"default deny", http.MethodGet, "https://a.com", []context.Handler{rules.handle}, 200, ""},
+		{"default preflight", http.MethodOptions, "https://a.com", []context.Handler{rules.handle}, 200, ""},
+		{"route allowed", http.MethodGet, "https://a.com", []context.Handler{rules.handle, route}, 200, "https://a.com"},
+		{"route preflight", http.MethodOptions, "https://a.com", []context.Handler{rules.handle, route}, 204, "https://a.com"},
+		{"route denied", http.MethodOptions, "https://evil.com", []context.Handler{rules.handle, route}, 403, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+
+			rec := testServe(req, tt.handlers...)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if v := rec.Header().Get("Access-Control-Allow-Origin"); v != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", v, tt.allowOrigin)
+			}
+		})
+	}
+}
@@ -2,14 +2,20 @@ package lama
 
 import (
 	"bytes"
+	stdContext "context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/emirpasic/gods/maps/linkedhashmap"
 	"github.com/jmoiron/sqlx"
+	"github.com/kataras/iris/v12/middleware/requestid"
 	"github.com/spf13/cast"
+	"net/url"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 )
 
 type SqlxDB = *sqlx.DB
@@ -21,13 +27,58 @@ type AddFn func(q *Sql)
 var DB *Database
 var DefaultDB SqlType
 
+// DBConf 配置[db]，slowQuery 为慢查询阈值(毫秒)
+// sqlComment 开启后在 SQL 末尾附加 sqlcommenter 注释，带上请求 ID、路由、服务名和 traceparent
+type DBConf struct {
+	SlowQuery  int  `json:"slowQuery"`
+	Explain    bool `json:"explain"`
+	SqlComment bool `json:"sqlComment"`
+}
+
+type sqlLogger interface {
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+}
+
 type Database struct {
-	db SqlxDB
+	db  SqlxDB
+	log Log
+	ctx stdContext.Context
 }
 
-func (s *Database) Init(db SqlxDB) {
+func (s *Database) Init(db SqlxDB, log Log) error {
+	err := Conf.Define("db", DBConf{})
+	if err != nil {
+		return err
+	}
+
 	DB = s
 	s.db = db
+	s.log = log
+	return nil
+}
+
+func (s *Database) logger() Log {
+	if s.log == nil {
+		return NamedLog("database")
+	}
+	return s.log
+}
+
+// WithContext 返回绑定 ctx 的 Database，传入 iris 请求时 SQL 日志带上请求信息
+// ctx 取消或超时时正在执行的查询随之取消
+func (s *Database) WithContext(ctx stdContext.Context) *Database {
+	db := *s
+	db.ctx = ctx
+	return &db
+}
+
+// queryCtx 返回执行查询的 context，未绑定时为 Background
+func (s *Database) queryCtx() stdContext.Context {
+	if s.ctx == nil {
+		return stdContext.Background()
+	}
+	return s.ctx
 }
 
 func (s *Database) GetDB() SqlxDB {
@@ -112,12 +163,7 @@ func (s *Database) AddRow(table string, fields string, values []any, fn ...AddFn
 		fn[0](insert)
 	}
 
-	query, args := s.toSql(insert)
-	res, err := s.GetDB().Exec(query, args...)
-	if err != nil {
-		panic(err)
-	}
-	return &SqlResult{res}
+	return s.exec("add", insert)
 }
 
 func (s *Database) Save(table string, row any, fn SaveFn) *SqlResult {
@@ -201,12 +247,7 @@ func (s *Database) SaveRow(table string, fields []string, values []any, where *S
 		}
 	}
 
-	query, args := s.toSql(NewSql("? ?", update, where))
-	res, err := s.GetDB().Exec(query, args...)
-	if err != nil {
-		panic(err)
-	}
-	return &SqlResult{res}
+	return s.exec("save", NewSql("? ?", update, where))
 }
 
 func (s *Database) toSql(sql *Sql) (query string, args []any) {
@@ -217,12 +258,143 @@ func (s *Database) toSql(sql *Sql) (query string, args []any) {
 	} else {
 		panic("error DefaultDB")
 	}
-	if Conf.Bool("app.showSql") {
-		Print.Info(query)
+	if c := s.sqlComment(); c != "" {
+		query += " " + c
 	}
 	return
 }
 
+// sqlComment 生成 sqlcommenter 格式的注释，未开启 db.sqlComment 或没有 ctx 时返回空
+//
+//	/*application='lama',request_id='...',route='%2Fuser%2F%7Bid%7D',traceparent='00-...'*/
+func (s *Database) sqlComment() string {
+	if s.ctx == nil || !Conf.Bool("db.sqlComment") {
+		return ""
+	}
+
+	tags := map[string]string{}
+	if name := Conf.String("app.name"); name != "" {
+		tags["application"] = name
+	}
+	if l := ctxLog(s.ctx); l != nil && l.ctx != nil {
+		if id := requestid.Get(l.ctx); id != "" {
+			tags["request_id"] = id
+		}
+		if r := l.ctx.GetCurrentRoute(); r != nil {
+			tags["route"] = r.Path()
+		}
+	}
+	if span := SpanFrom(s.ctx); span != nil {
+		tags["traceparent"] = span.Traceparent()
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = sqlCommentEscape(k) + "='" + sqlCommentEscape(tags[k]) + "'"
+	}
+	return "/*" + strings.Join(parts, ",") + "*/"
+}
+
+// sqlCommentEscape URL 编码，结果不含引号、星号、斜杠和问号，不会提前结束注释或被当作占位符
+func sqlCommentEscape(v string) string {
+	return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+}
+
+func (s *Database) exec(op string, sql *Sql) *SqlResult {
+	query, args := s.toSql(sql)
+	defer s.observe(op, query, args, time.Now())
+
+	res, err := s.GetDB().ExecContext(s.queryCtx(), query, args...)
+	if err != nil {
+		panic(s.dbError(err))
+	}
+	return &SqlResult{res}
+}
+
+// observe 记录 SQL 耗时、指标和追踪，超过 db.slowQuery 时告警
+func (s *Database) observe(op, query string, args []any, start time.Time) {
+	dur := time.Since(start)
+	dbQueries.Inc(op)
+	dbDuration.Observe(dur.Seconds(), op)
+	if span := StartSpan(s.ctx, "db."+op, "client"); span != nil {
+		span.Start, span.End = start, start.Add(dur)
+		span.SetAttr("db.system", dbSystem())
+		span.SetAttr("db.operation", op)
+		span.SetAttr("db.statement", query)
+		span.Finish()
+	}
+	if Conf.Bool("app.showSql") {
+		s.sqlLog().Infof("%s [%s]", query, dur)
+	}
+
+	slow := time.Duration(Conf.Int("db.slowQuery")) * time.Millisecond
+	if slow <= 0 || dur < slow {
+		return
+	}
+
+	slowQueries.Add(1)
+	fields := Fields{
+		"op":       op,
+		"sql":      query,
+		"params":   len(args),
+		"duration": dur.Milliseconds(),
+	}
+	if Conf.Bool("db.explain") && DefaultDB == PGSQL {
+		fields["explain"] = s.explain(query, args)
+	}
+	s.sqlLog().Warnf("Slow Query %s %s (%d params): %s", op, dur, len(args), query, fields)
+}
+
+// dbError 转换查询错误，ctx 已超时或取消时按 ctx 的错误处理，驱动返回的错误作为原因
+func (s *Database) dbError(err error) error {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		if e, ok := AsError(DBError(s.ctx.Err())); ok {
+			return e.Wrap(err)
+		}
+	}
+	return DBError(err)
+}
+
+func dbSystem() string {
+	if DefaultDB == MYSQL {
+		return "mysql"
+	}
+	return "postgresql"
+}
+
+func (s *Database) sqlLog() sqlLogger {
+	if l := ctxLog(s.ctx); l != nil {
+		return l.With(s.logger())
+	}
+	return s.logger()
+}
+
+func (s *Database) explain(query string, args []any) string {
+	rows, err := s.GetDB().Query("EXPLAIN "+query, args...)
+	if err != nil {
+		return err.Error()
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var line string
+		if rows.Scan(&line) == nil {
+			plan = append(plan, line)
+		}
+	}
+	return strings.Join(plan, "\n")
+}
+
 func (s *Database) Del(table string, fn DelFn) *SqlResult {
 	if table == "" {
 		panic("table is empty")
@@ -234,13 +406,7 @@ func (s *Database) Del(table string, fn DelFn) *SqlResult {
 	where := NewSqlOptional("WHERE")
 	fn(where)
 
-	del := NewSql("? ?", from, where)
-	query, args := s.toSql(del)
-	res, err := s.GetDB().Exec(query, args...)
-	if err != nil {
-		panic(err)
-	}
-	return &SqlResult{res}
+	return s.exec("del", NewSql("? ?", from, where))
 }
 
 func (s *Database) querySql(table string, fn SelectFn) (string, []any) {
@@ -261,11 +427,13 @@ func (s *Database) querySql(table string, fn SelectFn) (string, []any) {
 
 func (s *Database) Select(table string, fn SelectFn) (rows Rows) {
 	query, args := s.querySql(table, fn)
-	res, err := s.GetDB().Queryx(query, args...)
-	defer res.Close()
+	defer s.observe("select", query, args, time.Now())
+
+	res, err := s.GetDB().QueryxContext(s.queryCtx(), query, args...)
 	if err != nil {
-		panic(err)
+		panic(s.dbError(err))
 	}
+	defer res.Close()
 
 	cols, _ := res.Columns()
 	colTypes, _ := res.ColumnTypes()
@@ -273,7 +441,7 @@ func (s *Database) Select(table string, fn SelectFn) (rows Rows) {
 	for res.Next() {
 		values, err := res.SliceScan()
 		if err != nil {
-			panic(err)
+			panic(s.dbError(err))
 		}
 
 		row := NewRow()
@@ -283,13 +451,19 @@ func (s *Database) Select(table string, fn SelectFn) (rows Rows) {
 
 		rows = append(rows, row)
 	}
+	// 遍历中途的错误(如查询被取消)只能由 Err 取得
+	if err := res.Err(); err != nil {
+		panic(s.dbError(err))
+	}
 
 	return
 }
 
 func (s *Database) Get(table string, fn SelectFn) (row *Row) {
 	query, args := s.querySql(table, fn)
-	res := s.GetDB().QueryRowx(query, args...)
+	defer s.observe("get", query, args, time.Now())
+
+	res := s.GetDB().QueryRowxContext(s.queryCtx(), query, args...)
 
 	cols, err := res.Columns()
 	colTypes, err := res.ColumnTypes()
@@ -300,7 +474,7 @@ func (s *Database) Get(table string, fn SelectFn) (row *Row) {
 	}
 
 	if err != nil {
-		panic(err)
+		panic(s.dbError(err))
 	}
 
 	if len(values) > 0 {
@@ -0,0 +1,149 @@
+package lama
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+var mysqlKeyRe = regexp.MustCompile(`for key '([^']+)'`)
+var mysqlFKRe = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+
+// DBError 将数据库驱动错误转换为 *Error，无法识别时原样返回
+func DBError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := AsError(err); ok {
+		return err
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound("").WithCode("no_rows").Wrap(err)
+	}
+	// 请求超时时取消的查询为 504，客户端断开时取消的查询为 499，不作为服务端错误
+	if errors.Is(err, context.DeadlineExceeded) {
+		return GatewayTimeout("query timed out").Wrap(err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return ClientClosed("").Wrap(err)
+	}
+
+	var pe *pq.Error
+	if errors.As(err, &pe) {
+		if e := pgError(pe); e != nil {
+			return e.Wrap(err)
+		}
+		return err
+	}
+
+	if num, msg, ok := mysqlError(err); ok {
+		if e := myError(num, msg); e != nil {
+			return e.Wrap(err)
+		}
+	}
+	return err
+}
+
+func pgError(e *pq.Error) *Error {
+	switch e.Code {
+	case "23505":
+		return Conflict(fmt.Sprintf("duplicate value violates %s", e.Constraint)).
+			WithCode("unique_violation").
+			WithDetails(map[string]any{"constraint": e.Constraint})
+
+	case "23503":
+		// 删除或更新仍被引用的父表记录为 409，写入不存在的引用为 422
+		err := Unprocessable(fmt.Sprintf("reference violates %s", e.Constraint))
+		if strings.HasPrefix(e.Message, "update or delete on table") {
+			err = Conflict(fmt.Sprintf("row is still referenced by %s", e.Constraint))
+		}
+		return err.WithCode("foreign_key_violation").
+			WithDetails(map[string]any{"constraint": e.Constraint})
+
+	case "23502":
+		return Unprocessable(fmt.Sprintf("%s cannot be null", e.Column)).
+			WithCode("not_null_violation").
+			WithDetails(map[string]any{"column": e.Column})
+
+	case "23514":
+		return Unprocessable(fmt.Sprintf("value violates %s", e.Constraint)).
+			WithCode("check_violation").
+			WithDetails(map[string]any{"constraint": e.Constraint})
+
+	// statement_timeout 和取消查询都是 57014，这里按超时处理，
+	// 客户端断开取消的查询由 Database.dbError 按 ctx 转换为 499
+	case "57014":
+		return GatewayTimeout("query canceled")
+
+	case "40001", "40P01":
+		return Unavailable("transaction conflict, please retry").
+			WithCode("serialization_failure").
+			WithDetails(map[string]any{"retryable": true})
+	}
+	return nil
+}
+
+func myError(num int, msg string) *Error {
+	switch num {
+	case 1062:
+		key := ""
+		if m := mysqlKeyRe.FindStringSubmatch(msg); m != nil {
+			key = m[1]
+		}
+		return Conflict(fmt.Sprintf("duplicate value violates %s", key)).
+			WithCode("unique_violation").
+			WithDetails(map[string]any{"constraint": key})
+
+	case 1451, 1452:
+		key := ""
+		if m := mysqlFKRe.FindStringSubmatch(msg); m != nil {
+			key = m[1]
+		}
+		err := Unprocessable(fmt.Sprintf("reference violates %s", key))
+		if num == 1451 {
+			err = Conflict(fmt.Sprintf("row is still referenced by %s", key))
+		}
+		return err.WithCode("foreign_key_violation").
+			WithDetails(map[string]any{"constraint": key})
+
+	case 1048:
+		return Unprocessable(msg).WithCode("not_null_violation")
+
+	case 3819:
+		return Unprocessable(msg).WithCode("check_violation")
+
+	case 3024:
+		return GatewayTimeout("query timed out")
+
+	case 1213, 1205:
+		return Unavailable("transaction conflict, please retry").
+			WithCode("serialization_failure").
+			WithDetails(map[string]any{"retryable": true})
+	}
+	return nil
+}
+
+// mysqlError 读取 *mysql.MySQLError 的 Number 和 Message，不依赖 MySQL 驱动
+func mysqlError(err error) (int, string, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		if v.Elem().Type().String() != "mysql.MySQLError" {
+			continue
+		}
+		num := v.Elem().FieldByName("Number")
+		msg := v.Elem().FieldByName("Message")
+		if num.IsValid() && msg.IsValid() {
+			return int(num.Uint()), msg.String(), true
+		}
+	}
+	return 0, "", false
+}
@@ -0,0 +1,86 @@
+package lama
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestDBError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"no rows", sql.ErrNoRows, 404, "no_rows"},
+		{"wrapped no rows", fmt.Errorf("get user: %w", sql.ErrNoRows), 404, "no_rows"},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), 504, "timeout"},
+		{"client closed", fmt.Errorf("query: %w", context.Canceled), StatusClientClosed, "client_closed"},
+		{"unique", &pq.Error{Code: "23505", Constraint: "users_email_key"}, 409, "unique_violation"},
+		{"statement timeout", &pq.Error{Code: "57014"}, 504, "timeout"},
+		{"pg foreign key insert", &pq.Error{Code: "23503", Message: `insert or update on table "orders" violates foreign key constraint`}, 422, "foreign_key_violation"},
+		{"pg foreign key delete", &pq.Error{Code: "23503", Message: `update or delete on table "users" violates foreign key constraint`}, 409, "foreign_key_violation"},
+		{"pg not null", &pq.Error{Code: "23502", Column: "name"}, 422, "not_null_violation"},
+		{"pg check", &pq.Error{Code: "23514", Constraint: "price_positive"}, 422, "check_violation"},
+		{"pg serialization", &pq.Error{Code: "40001"}, 503, "serialization_failure"},
+		{"pg deadlock", &pq.Error{Code: "40P01"}, 503, "serialization_failure"},
+		{"mysql duplicate", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'users.email'"}, 409, "unique_violation"},
+		{"mysql foreign key", &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`db`.`orders`, CONSTRAINT `orders_user_fk` FOREIGN KEY (`user_id`))"}, 422, "foreign_key_violation"},
+		{"mysql referenced", &mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row: a foreign key constraint fails (CONSTRAINT `orders_user_fk`)"}, 409, "foreign_key_violation"},
+		{"mysql not null", &mysql.MySQLError{Number: 1048, Message: "Column 'name' cannot be null"}, 422, "not_null_violation"},
+		{"mysql wrapped", fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}), 409, "unique_violation"},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, 503, "serialization_failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := AsError(DBError(tt.err))
+			if !ok {
+				t.Fatalf("DBError(%v) is not *Error", tt.err)
+			}
+			if e.Status != tt.status || e.Code != tt.code {
+				t.Errorf("DBError(%v) = %d %s, want %d %s", tt.err, e.Status, e.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestDatabaseDBError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancel := context.WithTimeout(context.Background(), -1)
+	defer cancel()
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"no context", nil, 504},
+		{"active context", context.Background(), 504},
+		{"client closed", canceled, StatusClientClosed},
+		{"timed out", expired, 504},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &pq.Error{Code: "57014"}
+			s := &Database{ctx: tt.ctx}
+			e, ok := AsError(s.dbError(err))
+			if !ok {
+				t.Fatal("dbError() is not *Error")
+			}
+			if e.Status != tt.status {
+				t.Errorf("dbError() status = %d, want %d", e.Status, tt.status)
+			}
+			var pe *pq.Error
+			if !errors.As(e, &pe) {
+				t.Errorf("dbError() cause = %v, want pq error", e.Cause)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package lama
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gookit/validate"
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+// Error 应用错误，包含 HTTP 状态码、业务错误码、消息、详情和原始错误
+type Error struct {
+	Status  int
+	Code    string
+	Msg     string
+	Details any
+	Cause   error
+}
+
+func NewError(status int, code, msg string) *Error {
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	return &Error{Status: status, Code: code, Msg: msg}
+}
+
+func BadRequest(msg string) *Error {
+	return NewError(http.StatusBadRequest, "bad_request", msg)
+}
+
+func Unauthorized(msg string) *Error {
+	return NewError(http.StatusUnauthorized, "unauthorized", msg)
+}
+
+func Forbidden(msg string) *Error {
+	return NewError(http.StatusForbidden, "forbidden", msg)
+}
+
+func NotFound(msg string) *Error {
+	return NewError(http.StatusNotFound, "not_found", msg)
+}
+
+func Conflict(msg string) *Error {
+	return NewError(http.StatusConflict, "conflict", msg)
+}
+
+func Unprocessable(msg string) *Error {
+	return NewError(http.StatusUnprocessableEntity, "unprocessable", msg)
+}
+
+func TooManyRequests(msg string) *Error {
+	return NewError(http.StatusTooManyRequests, "too_many_requests", msg)
+}
+
+// StatusClientClosed 客户端在响应前断开，沿用 nginx 的 499
+const StatusClientClosed = 499
+
+func ClientClosed(msg string) *Error {
+	if msg == "" {
+		msg = "client closed request"
+	}
+	return NewError(StatusClientClosed, "client_closed", msg)
+}
+
+func Internal(msg string) *Error {
+	return NewError(http.StatusInternalServerError, "internal", msg)
+}
+
+func Unavailable(msg string) *Error {
+	return NewError(http.StatusServiceUnavailable, "unavailable", msg)
+}
+
+func GatewayTimeout(msg string) *Error {
+	return NewError(http.StatusGatewayTimeout, "timeout", msg)
+}
+
+func (s *Error) Error() string {
+	if s.Cause != nil {
+		return fmt.Sprintf("%s: %v", s.Msg, s.Cause)
+	}
+	return s.Msg
+}
+
+func (s *Error) Unwrap() error {
+	return s.Cause
+}
+
+// WithCode 返回设置了业务错误码的副本
+func (s *Error) WithCode(code string) *Error {
+	e := *s
+	e.Code = code
+	return &e
+}
+
+// WithDetails 返回设置了详情的副本
+func (s *Error) WithDetails(details any) *Error {
+	e := *s
+	e.Details = details
+	return &e
+}
+
+// Wrap 返回包装了 cause 的副本
+func (s *Error) Wrap(cause error) *Error {
+	e := *s
+	e.Cause = cause
+	return &e
+}
+
+// AsError 从错误链中取得 *Error
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// toError 将 panic 值或返回的错误转换为 *Error
+func toError(v any, debug bool) *Error {
+	switch e := v.(type) {
+	case *Error:
+		return e
+
+	case string:
+		return NewError(http.StatusBadRequest, "", e)
+
+	case validate.Errors:
+		return NewError(http.StatusBadRequest, "", e.One()).WithDetails(fieldErrors(e))
+
+	case error:
+		if ae, ok := AsError(DBError(e)); ok {
+			return ae
+		}
+		err := NewError(http.StatusInternalServerError, "", "Server internal error").Wrap(e)
+		if debug {
+			err.Msg = e.Error()
+		}
+		return err
+
+	default:
+		err := NewError(http.StatusInternalServerError, "", "Server internal error")
+		if debug {
+			err.Msg = fmt.Sprint(v)
+		}
+		return err
+	}
+}
+
+// renderError 按错误风格输出错误，默认为 {state,msg,time,requestId}，stack 不为 nil 时表示 panic，日志带上调用栈
+func renderError(ctx *context.Context, v any, debug bool, stack []byte) {
+	err := toError(v, debug)
+	logError(ctx, err, stack)
+	writeError(ctx, err, debug)
+}
+
+// logError 记录并上报错误，5xx 为 Error 级别，4xx 为 Info 级别，panic 时都带调用栈
+func logError(ctx *context.Context, err *Error, stack []byte) {
+	msg := err.Error()
+	fields := Fields{"status": err.Status}
+	if q := redactQuery(ctx.Request().URL.Query()); q != nil {
+		fields["query"] = q
+	}
+	if stack != nil {
+		fields["panic"] = true
+		fields["stack"] = string(stack)
+		fields["ip"] = ctx.RemoteAddr()
+		// 文本格式不输出字段，调用栈附在消息后
+		if logFormat != "json" {
+			msg = fmt.Sprintf("Panic %s %s: %s\n%s", ctx.Method(), ctx.Path(), msg, stack)
+		}
+	}
+	if err.Status >= http.StatusInternalServerError {
+		Logger(ctx).Error(msg, fields)
+	} else {
+		Logger(ctx).Info(msg, fields)
+	}
+	report(ctx, err, stack)
+}
+
+// writeError 按错误风格输出错误
+func writeError(ctx *context.Context, err *Error, debug bool) {
+	if errorStyle(ctx) == "problem" {
+		ctx.StopWithStatus(err.Status)
+		ctx.Problem(problemBody(ctx, err, debug))
+		return
+	}
+
+	ret := map[string]any{
+		"state":     false,
+		"msg":       err.Msg,
+		"time":      time.Now().Unix(),
+		"requestId": requestid.Get(ctx),
+	}
+	if err.Code != "" {
+		ret["code"] = err.Code
+	}
+	if err.Details != nil {
+		ret["details"] = err.Details
+	}
+	if debug && err.Cause != nil {
+		ret["cause"] = err.Cause.Error()
+	}
+	ctx.StopWithJSON(err.Status, ret)
+}
+
+// problemBody 返回 RFC 7807 problem+json 内容，instance 为请求 ID
+func problemBody(ctx *context.Context, err *Error, debug bool) map[string]any {
+	typ := "about:blank"
+	if base := Conf.String("app.problemType"); base != "" && err.Code != "" {
+		typ = base + err.Code
+	}
+
+	ret := map[string]any{
+		"type":     typ,
+		"title":    http.StatusText(err.Status),
+		"status":   err.Status,
+		"detail":   err.Msg,
+		"instance": requestid.Get(ctx),
+	}
+	if err.Code != "" {
+		ret["code"] = err.Code
+	}
+	if fe, ok := err.Details.([]FieldError); ok {
+		ret["errors"] = fe
+	} else if err.Details != nil {
+		ret["details"] = err.Details
+	}
+	if debug && err.Cause != nil {
+		ret["cause"] = err.Cause.Error()
+	}
+	return ret
+}
+
+const errorStyleKey = "lama.errorStyle"
+
+// ErrorStyle 设置路由组的错误输出风格 envelope/problem，覆盖 app.errorStyle
+//
+//	party.Use(lama.ErrorStyle("problem"))
+func ErrorStyle(style string) context.Handler {
+	return func(ctx *context.Context) {
+		ctx.Values().Set(errorStyleKey, style)
+		ctx.Next()
+	}
+}
+
+// errorStyle 依次按 Accept、路由组、app.errorStyle 决定错误输出风格
+func errorStyle(ctx *context.Context) string {
+	if strings.Contains(ctx.GetHeader("Accept"), context.ContentJSONProblemHeaderValue) {
+		return "problem"
+	}
+	if style := ctx.Values().GetString(errorStyleKey); style != "" {
+		return style
+	}
+	return Conf.String("app.errorStyle", "envelope")
+}
+
+// FieldError 字段校验错误
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Msg   string `json:"msg"`
+}
+
+func fieldErrors(es validate.Errors) []FieldError {
+	var list []FieldError
+	for field, ms := range es {
+		for rule, msg := range ms {
+			list = append(list, FieldError{Field: field, Rule: rule, Msg: msg})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Field != list[j].Field {
+			return list[i].Field < list[j].Field
+		}
+		return list[i].Rule < list[j].Rule
+	})
+	return list
+}
+
+// statusError 将处理函数给出的错误转换为 *Error，普通错误保留 status
+// 普通错误的消息可能含 SQL、路径等内部信息，非 debug 时只输出状态码对应的通用消息，原始错误记录在日志中
+func statusError(err error, status int, debug bool) *Error {
+	if ae, ok := AsError(DBError(err)); ok {
+		return ae
+	}
+	e := NewError(status, "", "").Wrap(err)
+	if status >= http.StatusInternalServerError {
+		e.Msg = "Server internal error"
+	}
+	if debug {
+		e.Msg = err.Error()
+	}
+	return e
+}
+
+// handleError 渲染 MVC 控制器返回的错误，未设置错误状态码的普通错误为 500
+func handleError(ctx *context.Context, err error) {
+	status := ctx.GetStatusCode()
+	if status < http.StatusBadRequest {
+		status = http.StatusInternalServerError
+	}
+	debug := Conf.Bool("app.debug")
+	renderError(ctx, statusError(err, status, debug), debug, nil)
+}
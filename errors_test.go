@@ -0,0 +1,56 @@
+package lama
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestHandleError(t *testing.T) {
+	internal := errors.New(`pq: relation "users" does not exist`)
+
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		debug  bool
+		want   int
+		msg    string
+	}{
+		{"plain error", 0, internal, false, 500, "Server internal error"},
+		{"plain error debug", 0, internal, true, 500, internal.Error()},
+		{"plain error with status", 404, internal, false, 404, "Not Found"},
+		{"lama error", 0, Conflict("name taken"), false, 409, "name taken"},
+		{"db error", 0, &Error{Status: 422, Msg: "bad ref"}, false, 422, "bad ref"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConf(t, map[string]any{"app.debug": tt.debug})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := testServe(req, func(ctx *context.Context) {
+				if tt.status != 0 {
+					ctx.StatusCode(tt.status)
+				}
+				handleError(ctx, tt.err)
+			})
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			var body struct {
+				Msg string `json:"msg"`
+			}
+			err := json.Unmarshal(rec.Body.Bytes(), &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body.Msg != tt.msg {
+				t.Errorf("msg = %q, want %q", body.Msg, tt.msg)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ go 1.19
 
 require (
 	github.com/emirpasic/gods v1.18.1
+	github.com/go-sql-driver/mysql v1.6.0
 	github.com/gookit/config/v2 v2.1.8-0.20221111022649-a5a75e7709ec
 	github.com/gookit/validate v1.4.4
+	github.com/iris-contrib/schema v0.0.6
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/kataras/golog v0.1.7
 	github.com/kataras/iris/v12 v12.2.0-beta6.0.20221024071155-f4a9d41462e6
@@ -37,7 +39,6 @@ require (
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/imdario/mergo v0.3.13 // indirect
 	github.com/iris-contrib/go.uuid v2.0.0+incompatible // indirect
-	github.com/iris-contrib/schema v0.0.6 // indirect
 	github.com/josharian/intern v1.0.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/kataras/blocks v0.0.7 // indirect
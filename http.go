@@ -2,30 +2,157 @@ package lama
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/core/host"
 )
 
 type Http struct {
+	log      Log
+	redirect *http.Server
+	admin    bool
+}
+
+func (s *Http) Init(log Log) {
+	s.log = log
 }
 
-// Serve 启动核心
+// Serve 启动核心，监听 app.addr，配置了 app.tls.cert 时使用 HTTPS
+// app.unix 额外监听 unix socket，app.admin 在本机地址启动管理端
 func (s *Http) Serve() chan error {
-	errCh := make(chan error, 1)
-	Print.Info(fmt.Sprintf("App Version %s", Conf.String("app.version")))
+	errCh := make(chan error, 4)
+	s.log.Info(fmt.Sprintf("App Version %s", Conf.String("app.version")))
 
-	go func() {
-		addr := Conf.String("app.addr")
-		Print.Infof("HTTP Server Listening On http://localhost%s", addr)
-		err := NewIRISApp().Listen(addr)
+	app := NewIRISApp()
+	err := app.Build()
+	if err != nil {
+		errCh <- err
+		return errCh
+	}
+
+	var extra []func(app *iris.Application)
+	if path := Conf.String("app.unix"); path != "" {
+		ln, err := listenUnix(path)
 		if err != nil {
 			errCh <- err
+			return errCh
 		}
-	}()
+		extra = append(extra, func(app *iris.Application) {
+			su := app.NewHost(&http.Server{Addr: path}).Configure(tagListener("unix"))
+			go func() {
+				s.log.Infof("HTTP Server Listening On unix:%s", path)
+				err := su.Serve(ln)
+				if err != nil && err != http.ErrServerClosed {
+					errCh <- err
+				}
+			}()
+		})
+	}
+
+	err = s.serveMain(app, errCh, extra)
+	if err != nil {
+		errCh <- err
+		return errCh
+	}
+
+	if addr := Conf.String("app.admin"); addr != "" {
+		addr, err = adminAddr(addr)
+		if err != nil {
+			errCh <- err
+			return errCh
+		}
+		s.admin = true
+		go func() {
+			s.log.Infof("Admin Server Listening On http://%s", addr)
+			err := NewAdminApp().Run(iris.Addr(addr, tagListener("admin")))
+			if err != nil {
+				errCh <- err
+			}
+		}()
+	} else {
+		// 指标可能泄露内部信息，不自动挂到对外监听
+		s.log.Warn("Admin Server Disabled, /metrics Not Served Unless lama.MetricsHandler Is Mounted")
+	}
 
 	return errCh
 }
 
+// runHosts 在 Run 完成配置后先创建主监听，再依次创建 extra 中的附加监听，全部监听都在同一个 goroutine 中创建，不与 Run 并发修改 app
+func runHosts(addr string, serve func(su *host.Supervisor) error, extra []func(app *iris.Application)) iris.Runner {
+	return func(app *iris.Application) error {
+		su := app.NewHost(&http.Server{Addr: addr}).Configure(tagListener("http"))
+		for _, fn := range extra {
+			fn(app)
+		}
+		return serve(su)
+	}
+}
+
+func (s *Http) serveMain(app IRISApp, errCh chan error, extra []func(app *iris.Application)) error {
+	addr := Conf.String("app.addr")
+	var cfg TLSConf
+	if Conf.Exists("app.tls") {
+		err := Conf.Structure("app.tls", &cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Cert == "" {
+		go func() {
+			s.log.Infof("HTTP Server Listening On http://localhost%s", addr)
+			err := app.Run(runHosts(addr, (*host.Supervisor).ListenAndServe, extra))
+			if err != nil {
+				errCh <- err
+			}
+		}()
+		return nil
+	}
+
+	conf, err := newTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Redirect != "" {
+		s.redirect = newRedirectServer(cfg.Redirect, addr)
+		go func() {
+			s.log.Infof("HTTP Redirect Listening On http://localhost%s", cfg.Redirect)
+			err := s.redirect.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				errCh <- err
+			}
+		}()
+	}
+
+	go func() {
+		s.log.Infof("HTTPS Server Listening On https://localhost%s", addr)
+		serve := func(su *host.Supervisor) error {
+			return su.Serve(tls.NewListener(ln, conf))
+		}
+		err := app.Run(runHosts(ln.Addr().String(), serve, extra))
+		if err != nil {
+			errCh <- err
+		}
+	}()
+	return nil
+}
+
 func (s *Http) Stop() error {
-	Print.Info("HTTP Server Shutdown Gracefully")
+	s.log.Info("HTTP Server Shutdown Gracefully")
+	if s.redirect != nil {
+		s.redirect.Shutdown(context.Background())
+	}
+	if s.admin {
+		NewAdminApp().Shutdown(context.Background())
+	}
 	return NewIRISApp().Shutdown(context.Background())
 }
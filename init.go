@@ -2,9 +2,7 @@ package lama
 
 import (
 	gookit "github.com/gookit/config/v2"
-	"github.com/gookit/config/v2/toml"
 	"github.com/kataras/golog"
-	"log"
 	"os"
 	"path/filepath"
 )
@@ -15,7 +13,7 @@ func init() {
 }
 
 type Log = *golog.Logger
-type Cfg = *gookit.Config
+type Cfg = *Config
 
 var Conf Cfg
 var Print Log
@@ -30,31 +28,66 @@ func (s *provide) Provide() (Cfg, Log) {
 func newLog() Log {
 	if Print == nil {
 		Print = golog.Default
+		Print.RegisterFormatter(&textFormatter{})
+		Print.RegisterFormatter(&logFormatter{})
+
+		accessLog = Print
+
 		level := "debug"
+		format := "text"
 		if Conf != nil {
+			var cfg LogConf
+			var err error
+			Conf.define("log", LogConf{})
+			if Conf.Exists("log") {
+				err = Conf.Structure("log", &cfg)
+			}
+			if err == nil {
+				err = setLogSinks(cfg)
+			}
+			if err != nil {
+				// 在 Validate 中报告，不在导入时退出
+				Conf.deferError(&SchemaError{File: Conf.source("log"), Path: "log", Msg: err.Error()})
+			}
+
 			level = Conf.String("app.logLevel", "debug")
+			format = Conf.String("app.logFormat", "text")
+			Conf.Watch("app.logLevel", func(ch *CfgChange) {
+				Print.SetLevel(ch.String())
+				setLogLevels()
+			})
+			Conf.Watch("log.levels", func(ch *CfgChange) {
+				setLogLevels()
+			})
+			Conf.Watch("app.logFormat", func(ch *CfgChange) {
+				setLogFormat(ch.String())
+			})
 		}
 		Print.SetLevel(level)
+		setLogFormat(format)
+		if len(logFiles) > 0 {
+			watchReopen()
+		}
 	}
 	return Print
 }
 
 func newCfg() Cfg {
 	if Conf == nil {
-		gookit.AddDriver(toml.Driver)
-		Conf = gookit.Default()
-		Conf.WithOptions(func(opt *gookit.Options) {
-			opt.DecoderConfig.TagName = "json"
-		})
-		Conf.LoadFiles(GetWorkerDir() + "/cfg.json")
+		Conf = newConfig(gookit.Default())
+		Conf.Load(GetWorkerDir() + "/cfg.json")
+		// 在 Validate 中校验，不在导入时退出
+		Conf.define("app", AppConf{})
 	}
 	return Conf
 }
 
+// GetWorkerDir 返回程序所在目录，取不到绝对路径时返回相对路径
 func GetWorkerDir() string {
-	dir, err := filepath.Abs(filepath.Dir(os.Args[0]))
+	dir := filepath.Dir(os.Args[0])
+	abs, err := filepath.Abs(dir)
 	if err != nil {
-		log.Fatal(err)
+		return dir
 	}
-	return dir
+	return abs
 }
@@ -0,0 +1,44 @@
+package lama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gookit "github.com/gookit/config/v2"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// testConf 使用只含 values 的配置，测试结束后恢复
+func testConf(t *testing.T, values map[string]any) {
+	t.Helper()
+	old := Conf
+	Conf = newConfig(gookit.New("test"))
+	t.Cleanup(func() {
+		Conf = old
+	})
+
+	err := Conf.Overlay("test", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testServe 经过 handlers 处理请求，最后的处理函数输出 ok
+func testServe(req *http.Request, handlers ...context.Handler) *httptest.ResponseRecorder {
+	app := iris.New()
+	app.Logger().SetLevel("disable")
+	app.UseRouter(handlers...)
+	app.Any("/{p:path}", func(ctx *context.Context) {
+		ctx.WriteString("ok")
+	})
+	err := app.Build()
+	if err != nil {
+		panic(err)
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,144 @@
+package lama
+
+import (
+	stdContext "context"
+	"fmt"
+	"net"
+	stdpprof "net/http/pprof"
+	"os"
+	"time"
+
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/core/host"
+	"github.com/kataras/iris/v12/middleware/pprof"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+type listenerKey struct{}
+
+// tagListener 在请求 context 中记录所在监听的名称
+func tagListener(name string) host.Configurator {
+	return func(su *host.Supervisor) {
+		su.Server.ConnContext = func(ctx stdContext.Context, c net.Conn) stdContext.Context {
+			return stdContext.WithValue(ctx, listenerKey{}, name)
+		}
+	}
+}
+
+// ListenerName 返回请求所在的监听: http、unix、admin
+func ListenerName(ctx *context.Context) string {
+	if name, ok := ctx.Request().Context().Value(listenerKey{}).(string); ok {
+		return name
+	}
+	return "http"
+}
+
+var listenerHandlers = map[string][]context.Handler{}
+
+// UseListener 为监听 http、unix 添加各自的中间件，在内置中间件之后、路由之前执行，需在服务 Init 中调用
+// 管理端为独立的应用，使用 AdminApp.UseRouter
+//
+//	lama.UseListener("unix", trustProxy)
+//	lama.UseListener("http", lama.RateLimit(lama.RatePolicy{Limit: 100}))
+func UseListener(name string, handlers ...context.Handler) {
+	listenerHandlers[name] = append(listenerHandlers[name], handlers...)
+}
+
+// listenerMiddleware 依次执行请求所在监听的中间件，中间件未调用 Next 时停止
+func listenerMiddleware(ctx *context.Context) {
+	for _, h := range listenerHandlers[ListenerName(ctx)] {
+		if !ctx.Proceed(h) {
+			return
+		}
+	}
+	ctx.Next()
+}
+
+// OnListener 只对指定监听上的请求执行中间件
+//
+//	App.UseRouter(lama.OnListener("unix", handler))
+func OnListener(name string, h context.Handler) context.Handler {
+	return func(ctx *context.Context) {
+		if ListenerName(ctx) == name {
+			h(ctx)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// listenUnix 监听 unix socket，删除残留的 socket 文件
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	return net.Listen("unix", path)
+}
+
+// Admin 管理端应用，只监听本机地址 app.admin，提供健康检查、指标和调试路由
+type Admin struct {
+	*iris.Application
+}
+
+var AdminApp *Admin
+
+var startTime = time.Now()
+
+func NewAdminApp() *Admin {
+	if AdminApp == nil {
+		app := iris.New()
+		app.Configure(iris.WithoutInterruptHandler,
+			iris.WithoutServerError(iris.ErrServerClosed),
+			iris.WithoutStartupLog)
+		app.Logger().SetLevel(logLevel("iris"))
+
+		if Conf.Bool("app.recover") {
+			r := &Recover{debug: Conf.Bool("app.debug")}
+			err := r.Init(app)
+			if err != nil {
+				panic(err)
+			}
+		}
+		app.UseRouter(requestid.New())
+
+		app.Get("/health", func(ctx *context.Context) {
+			OK(ctx, Fields{
+				"status":  "up",
+				"version": Conf.String("app.version"),
+				"uptime":  int64(time.Since(startTime).Seconds()),
+			})
+		})
+
+		app.Get("/metrics", MetricsHandler)
+
+		p := pprof.New()
+		app.Any("/debug/pprof", p)
+		app.Any("/debug/pprof/{action:path}", p)
+		app.Any("/debug/pprof/cmdline", iris.FromStd(stdpprof.Cmdline))
+		app.Any("/debug/pprof/profile", iris.FromStd(stdpprof.Profile))
+		app.Any("/debug/pprof/symbol", iris.FromStd(stdpprof.Symbol))
+		app.Any("/debug/pprof/trace", iris.FromStd(stdpprof.Trace))
+
+		AdminApp = &Admin{app}
+	}
+	return AdminApp
+}
+
+// adminAddr 校验管理端地址只绑定本机，未指定主机时使用 127.0.0.1
+func adminAddr(addr string) (string, error) {
+	h, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if h == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if h == "localhost" {
+		return addr, nil
+	}
+	if ip := net.ParseIP(h); ip != nil && ip.IsLoopback() {
+		return addr, nil
+	}
+	return "", fmt.Errorf("app.admin must bind to localhost: %s", addr)
+}
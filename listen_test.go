@@ -0,0 +1,52 @@
+package lama
+
+import (
+	stdContext "context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestUseListener(t *testing.T) {
+	old := listenerHandlers
+	listenerHandlers = map[string][]context.Handler{}
+	t.Cleanup(func() {
+		listenerHandlers = old
+	})
+
+	UseListener("unix", func(ctx *context.Context) {
+		ctx.Header("X-Listener", "unix")
+		ctx.Next()
+	})
+	UseListener("http", func(ctx *context.Context) {
+		ctx.StopWithStatus(http.StatusForbidden)
+	})
+
+	tests := []struct {
+		listener string
+		status   int
+		header   string
+	}{
+		{"", http.StatusForbidden, ""},
+		{"http", http.StatusForbidden, ""},
+		{"unix", http.StatusOK, "unix"},
+		{"admin", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.listener, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.listener != "" {
+				req = req.WithContext(stdContext.WithValue(req.Context(), listenerKey{}, tt.listener))
+			}
+			rec := testServe(req, listenerMiddleware)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if v := rec.Header().Get("X-Listener"); v != tt.header {
+				t.Errorf("X-Listener = %q, want %q", v, tt.header)
+			}
+		})
+	}
+}
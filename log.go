@@ -0,0 +1,395 @@
+package lama
+
+import (
+	stdContext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+type Fields = golog.Fields
+
+// LogConf 配置[log]
+type LogConf struct {
+	Sinks  []SinkConf        `json:"sinks"`
+	Access *SinkConf         `json:"access"`
+	Error  *SinkConf         `json:"error"`
+	Levels map[string]string `json:"levels"`
+}
+
+var logs = make(map[string]Log)
+var logMu sync.Mutex
+var logFormat = "text"
+
+type reqLogKey struct{}
+
+// NamedLog 返回名为 name 的子日志，级别可通过 log.levels.<name> 单独设置
+func NamedLog(name string) Log {
+	name = strings.ToLower(name)
+
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	l, ok := logs[name]
+	if !ok {
+		l = Print.Child(name)
+		l.SetLevel(logLevel(name))
+		logs[name] = l
+	}
+	return l
+}
+
+// serviceLog 返回注入服务的日志，只有配置了 log.levels.<name> 的服务使用子日志，避免改变其它服务的级别和前缀
+func serviceLog(name string) Log {
+	if Conf != nil && Conf.Exists("log.levels."+strings.ToLower(name)) {
+		return NamedLog(name)
+	}
+	return Print
+}
+
+// registerLog 将已有的日志纳入 log.levels 管理
+func registerLog(name string, l Log) {
+	logMu.Lock()
+	logs[name] = l
+	logMu.Unlock()
+	l.SetLevel(logLevel(name))
+}
+
+func logLevel(name string) string {
+	if Conf == nil {
+		return Print.Level.String()
+	}
+	return Conf.String("log.levels."+name, Conf.String("app.logLevel", "debug"))
+}
+
+// setLogLevels 按配置刷新全部子日志的级别
+func setLogLevels() {
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	for name, l := range logs {
+		l.SetLevel(logLevel(name))
+	}
+}
+
+// accessLog 访问日志，未配置 log.access 时即为 Print
+var accessLog Log
+var logFiles []*RotateFile
+
+func newLogger(w io.Writer) Log {
+	l := golog.New()
+	l.SetOutput(w)
+	l.RegisterFormatter(&textFormatter{})
+	l.RegisterFormatter(&logFormatter{})
+	return l
+}
+
+// setLogFormat 设置日志格式 text/json
+func setLogFormat(format string) {
+	if format != "json" {
+		format = "text"
+	}
+	logFormat = format
+	Print.SetFormat(format)
+	if accessLog != Print {
+		accessLog.SetFormat(format)
+	}
+
+	logMu.Lock()
+	for _, l := range logs {
+		l.SetFormat(format)
+	}
+	logMu.Unlock()
+}
+
+// setLogSinks 按配置[log]设置日志输出
+func setLogSinks(cfg LogConf) error {
+	var out io.Writer = Print.Printer
+	if len(cfg.Sinks) > 0 {
+		w, err := openSinks(cfg.Sinks...)
+		if err != nil {
+			return err
+		}
+		Print.SetOutput(w)
+		out = w
+	}
+
+	if cfg.Error != nil {
+		w, err := openSinks(*cfg.Error)
+		if err != nil {
+			return err
+		}
+		w = io.MultiWriter(out, w)
+		Print.SetLevelOutput("error", w)
+		Print.SetLevelOutput("fatal", w)
+	}
+
+	accessLog = Print
+	if cfg.Access != nil {
+		w, err := openSinks(*cfg.Access)
+		if err != nil {
+			return err
+		}
+		accessLog = newLogger(w)
+	}
+	return nil
+}
+
+func openSinks(cfgs ...SinkConf) (io.Writer, error) {
+	var writers []io.Writer
+	for _, cfg := range cfgs {
+		switch cfg.Type {
+		case "", "stdout":
+			writers = append(writers, os.Stdout)
+		case "stderr":
+			writers = append(writers, os.Stderr)
+		case "file":
+			f, err := OpenRotateFile(cfg)
+			if err != nil {
+				return nil, err
+			}
+			logFiles = append(logFiles, f)
+			writers = append(writers, f)
+		default:
+			return nil, fmt.Errorf("log sink: unknown type %s", cfg.Type)
+		}
+	}
+
+	if len(writers) == 1 {
+		return writers[0], nil
+	}
+	return io.MultiWriter(writers...), nil
+}
+
+// reopenLogs 重新打开全部日志文件
+func reopenLogs() {
+	for _, f := range logFiles {
+		err := f.Reopen()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "log reopen %s: %v\n", f.cfg.Path, err)
+		}
+	}
+}
+
+// logFields 返回请求相关的日志字段
+func logFields(ctx *context.Context, fields ...Fields) Fields {
+	out := Logger(ctx).Fields()
+	for _, f := range fields {
+		for k, v := range f {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Logger 返回请求日志，每条日志带上请求 ID、方法、路由和用户
+func Logger(ctx *context.Context) *ReqLog {
+	if l, ok := ctx.Value(reqLogKey{}).(*ReqLog); ok {
+		return l
+	}
+
+	l := &ReqLog{ctx: ctx, log: Print}
+	setRequestValue(ctx, reqLogKey{}, l)
+	return l
+}
+
+// requestLogger 在请求开始时创建请求日志，之后取得的 ctx.Request().Context() 都带有它
+func requestLogger(ctx *context.Context) {
+	Logger(ctx)
+	ctx.Next()
+}
+
+// setRequestValue 将值放入请求的 context，ctx.Request().Context() 传给 Database 等时可以取回
+func setRequestValue(ctx *context.Context, key, val any) {
+	r := ctx.Request()
+	ctx.ResetRequest(r.WithContext(stdContext.WithValue(r.Context(), key, val)))
+}
+
+// ctxLog 从 context 中取得请求日志，没有时返回 nil
+func ctxLog(ctx stdContext.Context) *ReqLog {
+	if ctx == nil {
+		return nil
+	}
+	if c, ok := ctx.(*context.Context); ok {
+		return Logger(c)
+	}
+	l, _ := ctx.Value(reqLogKey{}).(*ReqLog)
+	return l
+}
+
+// ReqLog 请求日志
+type ReqLog struct {
+	ctx *context.Context
+	log Log
+}
+
+// With 返回使用 l 输出的请求日志
+func (s *ReqLog) With(l Log) *ReqLog {
+	return &ReqLog{ctx: s.ctx, log: l}
+}
+
+func (s *ReqLog) Fields() Fields {
+	ctx := s.ctx
+	fields := Fields{
+		"requestId": requestid.Get(ctx),
+		"method":    ctx.Method(),
+		"path":      ctx.Path(),
+	}
+	if r := ctx.GetCurrentRoute(); r != nil {
+		fields["route"] = r.Path()
+	}
+	if span := SpanFrom(ctx); span != nil {
+		fields["traceId"] = span.TraceID
+	}
+	if u := ctx.User(); u != nil {
+		name, _ := u.GetUsername()
+		if name == "" {
+			name, _ = u.GetID()
+		}
+		if name != "" {
+			fields["user"] = name
+		}
+	}
+	return fields
+}
+
+func (s *ReqLog) print(level golog.Level, msg string, extra Fields) {
+	if s.log.Level < level {
+		return
+	}
+
+	fields := s.Fields()
+	for k, v := range extra {
+		fields[k] = v
+	}
+	if logFormat != "json" {
+		msg = fmt.Sprintf("[%s] %s", fields["requestId"], msg)
+	}
+	s.log.Log(level, msg, fields)
+}
+
+func (s *ReqLog) output(level golog.Level, v []any) {
+	args, fields := splitFields(v)
+	s.print(level, fmt.Sprint(args...), fields)
+}
+
+func (s *ReqLog) outputf(level golog.Level, format string, v []any) {
+	args, fields := splitFields(v)
+	s.print(level, fmt.Sprintf(format, args...), fields)
+}
+
+func (s *ReqLog) Debug(v ...any) {
+	s.output(golog.DebugLevel, v)
+}
+
+func (s *ReqLog) Debugf(format string, args ...any) {
+	s.outputf(golog.DebugLevel, format, args)
+}
+
+func (s *ReqLog) Info(v ...any) {
+	s.output(golog.InfoLevel, v)
+}
+
+func (s *ReqLog) Infof(format string, args ...any) {
+	s.outputf(golog.InfoLevel, format, args)
+}
+
+func (s *ReqLog) Warn(v ...any) {
+	s.output(golog.WarnLevel, v)
+}
+
+func (s *ReqLog) Warnf(format string, args ...any) {
+	s.outputf(golog.WarnLevel, format, args)
+}
+
+func (s *ReqLog) Error(v ...any) {
+	s.output(golog.ErrorLevel, v)
+}
+
+func (s *ReqLog) Errorf(format string, args ...any) {
+	s.outputf(golog.ErrorLevel, format, args)
+}
+
+// splitFields 分离参数中的 Fields
+func splitFields(v []any) ([]any, Fields) {
+	var args []any
+	var fields Fields
+	for _, a := range v {
+		if f, ok := a.(Fields); ok {
+			if fields == nil {
+				fields = make(Fields)
+			}
+			for k, val := range f {
+				fields[k] = val
+			}
+			continue
+		}
+		args = append(args, a)
+	}
+	return args, fields
+}
+
+// textFormatter 交由 golog 默认的文本格式输出
+type textFormatter struct {
+}
+
+func (s *textFormatter) String() string {
+	return "text"
+}
+
+func (s *textFormatter) Options(opts ...interface{}) golog.Formatter {
+	return s
+}
+
+func (s *textFormatter) Format(dest io.Writer, log *golog.Log) bool {
+	return false
+}
+
+// logFormatter 以 JSON lines 输出日志
+type logFormatter struct {
+}
+
+func (s *logFormatter) String() string {
+	return "json"
+}
+
+func (s *logFormatter) Options(opts ...interface{}) golog.Formatter {
+	return s
+}
+
+func (s *logFormatter) Format(dest io.Writer, log *golog.Log) bool {
+	rec := make(map[string]any, len(log.Fields)+5)
+	for k, v := range log.Fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		rec[k] = v
+	}
+
+	rec["time"] = log.Time.Format(time.RFC3339Nano)
+	rec["msg"] = log.Message
+	if level := log.Level.String(); level != "" {
+		rec["level"] = level
+	}
+	if name := Conf.String("app.name"); name != "" {
+		rec["service"] = name
+	}
+	if prefix := strings.TrimSuffix(log.Logger.Prefix, ": "); prefix != "" {
+		rec["logger"] = prefix
+	}
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return false
+	}
+	_, err = dest.Write(append(b, '\n'))
+	return err == nil
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package lama
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchReopen 收到 SIGUSR1 时重新打开日志文件
+func watchReopen() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			reopenLogs()
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package lama
+
+func watchReopen() {
+}
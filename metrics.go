@@ -0,0 +1,300 @@
+package lama
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+// Collector 以 Prometheus 文本格式输出指标
+type Collector interface {
+	Collect(w io.Writer)
+}
+
+var (
+	metricMu   sync.RWMutex
+	collectors []Collector
+)
+
+// RegisterMetric 注册自定义指标
+func RegisterMetric(c Collector) {
+	metricMu.Lock()
+	defer metricMu.Unlock()
+	collectors = append(collectors, c)
+}
+
+// WriteMetrics 输出全部指标
+func WriteMetrics(w io.Writer) {
+	metricMu.RLock()
+	list := append([]Collector{}, collectors...)
+	metricMu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range list {
+		c.Collect(bw)
+	}
+	bw.Flush()
+}
+
+// MetricsHandler 输出 /metrics，默认挂在管理端，未配置 app.admin 时需自行挂到受保护的路由
+func MetricsHandler(ctx *context.Context) {
+	ctx.ContentType("text/plain; version=0.0.4")
+	WriteMetrics(ctx)
+}
+
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	mu     sync.Mutex
+	values map[string][]float64
+}
+
+func newMetric(name, help, typ string, labels []string) *metric {
+	return &metric{name: name, help: help, typ: typ, labels: labels, values: make(map[string][]float64)}
+}
+
+func (s *metric) key(lv []string) string {
+	if len(lv) != len(s.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", s.name, len(s.labels), len(lv)))
+	}
+	return strings.Join(lv, "\xff")
+}
+
+func (s *metric) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.typ)
+}
+
+func (s *metric) sortedKeys() []string {
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelString 返回 {a="1",b="2"}，extra 为附加的 label 对
+func labelString(names []string, key string, extra ...string) string {
+	var values []string
+	if len(names) > 0 {
+		values = strings.Split(key, "\xff")
+	}
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, n+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter 计数器
+type Counter struct {
+	*metric
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newMetric(name, help, "counter", labels)}
+	RegisterMetric(c)
+	return c
+}
+
+func (s *Counter) Inc(lv ...string) {
+	s.Add(1, lv...)
+}
+
+func (s *Counter) Add(v float64, lv ...string) {
+	k := s.key(lv)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values[k] == nil {
+		s.values[k] = []float64{0}
+	}
+	s.values[k][0] += v
+}
+
+func (s *Counter) Collect(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header(w)
+	for _, k := range s.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", s.name, labelString(s.labels, k), formatFloat(s.values[k][0]))
+	}
+}
+
+// Gauge 仪表
+type Gauge struct {
+	*metric
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newMetric(name, help, "gauge", labels)}
+	RegisterMetric(g)
+	return g
+}
+
+func (s *Gauge) Set(v float64, lv ...string) {
+	k := s.key(lv)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[k] = []float64{v}
+}
+
+func (s *Gauge) Add(v float64, lv ...string) {
+	k := s.key(lv)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values[k] == nil {
+		s.values[k] = []float64{0}
+	}
+	s.values[k][0] += v
+}
+
+func (s *Gauge) Collect(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header(w)
+	for _, k := range s.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", s.name, labelString(s.labels, k), formatFloat(s.values[k][0]))
+	}
+}
+
+// Histogram 直方图，buckets 为空时使用 DefaultBuckets
+type Histogram struct {
+	*metric
+	buckets []float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{newMetric(name, help, "histogram", labels), buckets}
+	RegisterMetric(h)
+	return h
+}
+
+// Observe 记录一个值，values 依次为各 bucket 计数、sum、count
+func (s *Histogram) Observe(v float64, lv ...string) {
+	k := s.key(lv)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vals := s.values[k]
+	if vals == nil {
+		vals = make([]float64, len(s.buckets)+2)
+		s.values[k] = vals
+	}
+	for i, b := range s.buckets {
+		if v <= b {
+			vals[i]++
+		}
+	}
+	vals[len(s.buckets)] += v
+	vals[len(s.buckets)+1]++
+}
+
+func (s *Histogram) Collect(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.header(w)
+	for _, k := range s.sortedKeys() {
+		vals := s.values[k]
+		for i, b := range s.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %s\n", s.name, labelString(s.labels, k, "le", formatFloat(b)), formatFloat(vals[i]))
+		}
+		count := vals[len(s.buckets)+1]
+		fmt.Fprintf(w, "%s_bucket%s %s\n", s.name, labelString(s.labels, k, "le", "+Inf"), formatFloat(count))
+		fmt.Fprintf(w, "%s_sum%s %s\n", s.name, labelString(s.labels, k), formatFloat(vals[len(s.buckets)]))
+		fmt.Fprintf(w, "%s_count%s %s\n", s.name, labelString(s.labels, k), formatFloat(count))
+	}
+}
+
+// CollectorFunc 在采集时计算指标
+type CollectorFunc func(w io.Writer)
+
+func (s CollectorFunc) Collect(w io.Writer) {
+	s(w)
+}
+
+// WriteSample 输出一个指标，供 CollectorFunc 使用
+func WriteSample(w io.Writer, name, help, typ string, value float64, labels ...string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	fmt.Fprintf(w, "%s%s %s\n", name, labelString(nil, "", labels...), formatFloat(value))
+}
+
+var (
+	httpRequests = NewCounter("http_requests_total",
+		"Total HTTP requests.", "route", "method", "status")
+	httpDuration = NewHistogram("http_request_duration_seconds",
+		"HTTP request latency in seconds.", nil, "route", "method", "status")
+	dbQueries = NewCounter("db_queries_total",
+		"Total Database queries.", "op")
+	dbDuration = NewHistogram("db_query_duration_seconds",
+		"Database query latency in seconds.", nil, "op")
+	// Ada 不重启出错的服务，没有重启次数
+	serviceErrors = NewCounter("ada_service_errors_total",
+		"Errors returned by Ada services.", "service")
+)
+
+func init() {
+	RegisterMetric(CollectorFunc(func(w io.Writer) {
+		WriteSample(w, "http_slow_requests_total", "Requests slower than app.slowRequest.", "counter", float64(slowRequests.Load()))
+		WriteSample(w, "db_slow_queries_total", "Queries slower than db.slowQuery.", "counter", float64(slowQueries.Load()))
+	}))
+	RegisterMetric(CollectorFunc(runtimeMetrics))
+}
+
+// httpMetrics 按路由、方法和状态码统计请求数和耗时
+func httpMetrics(ctx *context.Context) {
+	start := time.Now()
+	ctx.Next()
+
+	route := "unmatched"
+	if r := ctx.GetCurrentRoute(); r != nil {
+		route = r.Path()
+	}
+	status := strconv.Itoa(ctx.GetStatusCode())
+	httpRequests.Inc(route, ctx.Method(), status)
+	httpDuration.Observe(time.Since(start).Seconds(), route, ctx.Method(), status)
+}
+
+func runtimeMetrics(w io.Writer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	WriteSample(w, "go_goroutines", "Number of goroutines.", "gauge", float64(runtime.NumGoroutine()))
+	WriteSample(w, "go_memstats_alloc_bytes", "Bytes allocated and in use.", "gauge", float64(m.Alloc))
+	WriteSample(w, "go_memstats_sys_bytes", "Bytes obtained from system.", "gauge", float64(m.Sys))
+	WriteSample(w, "go_memstats_heap_inuse_bytes", "Heap bytes in use.", "gauge", float64(m.HeapInuse))
+	WriteSample(w, "go_memstats_heap_objects", "Number of allocated heap objects.", "gauge", float64(m.HeapObjects))
+	WriteSample(w, "go_gc_cycles_total", "Completed GC cycles.", "counter", float64(m.NumGC))
+	WriteSample(w, "go_gc_pause_seconds_total", "Total GC pause time.", "counter", float64(m.PauseTotalNs)/1e9)
+	WriteSample(w, "process_start_time_seconds", "Start time of the process.", "gauge", float64(startTime.Unix()))
+}
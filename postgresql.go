@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/gookit/validate"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"io"
+	"sync"
 	"time"
 )
 
@@ -26,16 +28,34 @@ type PGConf struct {
 	Timezone string `json:"timezone" validate:"required"`
 }
 
+func loadPGConf(c Cfg) (cfg PGConf, err error) {
+	err = c.Structure("pg", &cfg)
+	if err != nil {
+		return
+	}
+
+	v := validate.New(&cfg)
+	if !v.Validate() {
+		err = fmt.Errorf("postgresql config[pg]: %s", v.Errors.One())
+	}
+	return
+}
+
 func (s *PG) Provide() SqlxDB {
-	err := Conf.Structure("pg", &s.cfg)
+	err := Conf.Define("pg", PGConf{})
 	if err != nil {
 		panic(err)
 	}
 
-	v := validate.New(&s.cfg)
-	if !v.Validate() {
-		panic(fmt.Errorf("postgresql config[pg]: %s", v.Errors.One()))
+	cfg, err := loadPGConf(Conf)
+	if err != nil {
+		panic(err)
 	}
+	s.cfg = cfg
+	Conf.Check(func(c Cfg) error {
+		_, err := loadPGConf(c)
+		return err
+	})
 
 	s.dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s TimeZone=%s sslmode=disable", s.cfg.Host, s.cfg.Port, s.cfg.User, s.cfg.Passwd, s.cfg.DBName, s.cfg.Timezone)
 
@@ -56,11 +76,94 @@ func (s *PG) Provide() SqlxDB {
 	s.db = db
 	Print.Infof("Connected Postgresql %s", s.cfg.Host)
 
+	pgMu.Lock()
+	pgList = append(pgList, s)
+	pgMu.Unlock()
+
 	DefaultDB = PGSQL
 	return db
 }
 
+// PGOf 返回打开 db 的 *PG，不是 PG 提供的连接时返回 nil
+//
+//	func (s *MyService) Init(db lama.SqlxDB) { l, err := lama.PGOf(db).Listener("events") }
+func PGOf(db SqlxDB) *PG {
+	pgMu.Lock()
+	defer pgMu.Unlock()
+
+	for _, pg := range pgList {
+		if pg.db == db {
+			return pg
+		}
+	}
+	return nil
+}
+
+// Listener 创建 LISTEN/NOTIFY 监听连接
+func (s *PG) Listener(channel string) (*pq.Listener, error) {
+	l := pq.NewListener(s.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			Print.Errorf("Postgresql Listener %s %v", channel, err)
+		}
+	})
+
+	err := l.Listen(channel)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
 func (s *PG) Stop() error {
 	Print.Infof("Disconnect Postgresql %s", s.cfg.Host)
 	return s.db.Close()
 }
+
+var (
+	pgMu   sync.Mutex
+	pgList []*PG
+)
+
+func init() {
+	RegisterMetric(CollectorFunc(pgMetrics))
+}
+
+// pgMetrics 输出每个 PG 连接池的 sql.DBStats，label db 为数据库名
+func pgMetrics(w io.Writer) {
+	pgMu.Lock()
+	list := append([]*PG{}, pgList...)
+	pgMu.Unlock()
+
+	gauge := func(name, help string) *Gauge {
+		return &Gauge{newMetric(name, help, "gauge", []string{"db"})}
+	}
+	counter := func(name, help string) *Counter {
+		return &Counter{newMetric(name, help, "counter", []string{"db"})}
+	}
+	maxOpen := gauge("db_pool_max_open_connections", "Maximum number of open connections.")
+	open := gauge("db_pool_open_connections", "Established connections both in use and idle.")
+	inUse := gauge("db_pool_in_use_connections", "Connections currently in use.")
+	idle := gauge("db_pool_idle_connections", "Idle connections.")
+	wait := counter("db_pool_wait_total", "Total connections waited for.")
+	waitDur := counter("db_pool_wait_seconds_total", "Total time blocked waiting for a new connection.")
+	idleClosed := counter("db_pool_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.")
+	lifeClosed := counter("db_pool_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.")
+
+	for _, pg := range list {
+		st := pg.db.Stats()
+		name := pg.cfg.DBName
+		maxOpen.Set(float64(st.MaxOpenConnections), name)
+		open.Set(float64(st.OpenConnections), name)
+		inUse.Set(float64(st.InUse), name)
+		idle.Set(float64(st.Idle), name)
+		wait.Add(float64(st.WaitCount), name)
+		waitDur.Add(st.WaitDuration.Seconds(), name)
+		idleClosed.Add(float64(st.MaxIdleClosed), name)
+		lifeClosed.Add(float64(st.MaxLifetimeClosed), name)
+	}
+
+	for _, c := range []Collector{maxOpen, open, inUse, idle, wait, waitDur, idleClosed, lifeClosed} {
+		c.Collect(w)
+	}
+}
@@ -0,0 +1,326 @@
+package lama
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+// RatePolicy 限流策略
+//
+// algorithm: token 令牌桶(默认)、window 滑动窗口
+// limit: 每个窗口允许的请求数，为 0 时不限流
+// window: 窗口秒数，默认 60
+// burst: 令牌桶容量，默认等于 limit
+// key: 限流维度 ip(默认)、apikey、user，按认证后的调用方或用户，未认证时按 IP
+type RatePolicy struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Limit     int    `json:"limit"`
+	Window    int    `json:"window"`
+	Burst     int    `json:"burst"`
+	Key       string `json:"key"`
+}
+
+// RateConf 配置[rate]，parties 按路径前缀覆盖策略，如 [rate.parties."/api"]
+type RateConf struct {
+	RatePolicy `json:",squash"`
+	Parties    map[string]RatePolicy `json:"parties"`
+}
+
+// RateResult 一次限流判断的结果
+type RateResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateStore 限流存储，默认为内存，多实例共享时由服务 Provide 替换
+type RateStore interface {
+	Allow(key string, p RatePolicy) (RateResult, error)
+}
+
+var rateStore RateStore = NewMemoryRateStore()
+
+// userIDKey 由认证中间件设置的用户标识，key 为 user 时使用
+const userIDKey = "lama.userId"
+
+func (s RatePolicy) window() time.Duration {
+	if s.Window <= 0 {
+		return time.Minute
+	}
+	return time.Duration(s.Window) * time.Second
+}
+
+func (s RatePolicy) burst() int {
+	if s.Burst <= 0 {
+		return s.Limit
+	}
+	return s.Burst
+}
+
+// clientKey 按 key 取得客户端标识，只使用认证后的身份，不信任未校验的请求头
+func (s RatePolicy) clientKey(ctx *context.Context) string {
+	switch s.Key {
+	case "apikey":
+		if info := APIKeyFrom(ctx); info != nil {
+			return "apikey:" + info.ID
+		}
+	case "user":
+		if v := ctx.Values().GetString(userIDKey); v != "" {
+			return "user:" + v
+		}
+	}
+	return "ip:" + ctx.RemoteAddr()
+}
+
+var rateSeq atomic.Int64
+
+// RateLimit 返回按策略限流的中间件，用于路由组或路由
+//
+//	party.Use(lama.RateLimit(lama.RatePolicy{Limit: 10, Window: 1, Key: "user"}))
+//
+// key 为 apikey、user 时需放在认证中间件之后；多实例共享存储时应设置 name
+func RateLimit(p RatePolicy) context.Handler {
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("route%d", rateSeq.Add(1))
+	}
+	return func(ctx *context.Context) {
+		if limitRate(ctx, p) {
+			ctx.Next()
+		}
+	}
+}
+
+// limitRate 判断是否放行并输出 RateLimit-* 头，超限时返回 429
+func limitRate(ctx *context.Context, p RatePolicy) bool {
+	if p.Limit <= 0 {
+		return true
+	}
+
+	res, err := rateStore.Allow(p.Name+"|"+p.clientKey(ctx), p)
+	if err != nil {
+		// 存储不可用时放行
+		Logger(ctx).Warnf("Rate Limit Store Failed %v", err)
+		return true
+	}
+
+	// burst 大于 limit 时剩余令牌可能超过 limit，按 limit 输出
+	remaining := res.Remaining
+	if remaining > p.Limit {
+		remaining = p.Limit
+	}
+	ctx.Header("RateLimit-Limit", strconv.Itoa(p.Limit))
+	ctx.Header("RateLimit-Remaining", strconv.Itoa(remaining))
+	ctx.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Limit, int(p.window().Seconds())))
+	if res.Allowed {
+		return true
+	}
+
+	retry := ceilSeconds(res.RetryAfter)
+	if retry < 1 {
+		retry = 1
+	}
+	ctx.Header("Retry-After", strconv.Itoa(retry))
+	renderError(ctx, TooManyRequests("").WithDetails(Fields{"retryAfter": retry}), false, nil)
+	return false
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type rateRules struct {
+	def     RatePolicy
+	parties []string
+	policy  map[string]RatePolicy
+}
+
+// newRateLimit 按配置[rate]创建全局限流中间件，配置变化时重新加载
+func newRateLimit() context.Handler {
+	err := Conf.Define("rate", RateConf{})
+	if err != nil {
+		panic(err)
+	}
+
+	var rules atomic.Pointer[rateRules]
+	load := func() error {
+		r, err := loadRate()
+		if err == nil {
+			rules.Store(r)
+		}
+		return err
+	}
+	err = load()
+	if err != nil {
+		panic(err)
+	}
+
+	Conf.Watch("rate", func(ch *CfgChange) {
+		err := load()
+		if err != nil {
+			Print.Errorf("Rate Reload Failed %v", err)
+		}
+	})
+
+	return func(ctx *context.Context) {
+		if limitRate(ctx, rules.Load().match(ctx.Path())) {
+			ctx.Next()
+		}
+	}
+}
+
+// check 全局限流在认证之前执行，只能按 IP，按 apikey、user 限流需在认证之后使用 RateLimit
+func (s RatePolicy) check(party string) error {
+	if s.Key == "" || s.Key == "ip" {
+		return nil
+	}
+	if party != "" {
+		return fmt.Errorf("rate.parties.%q: key %s requires authentication, use lama.RateLimit after it", party, s.Key)
+	}
+	return fmt.Errorf("rate: key %s requires authentication, use lama.RateLimit after it", s.Key)
+}
+
+func loadRate() (*rateRules, error) {
+	var cfg RateConf
+	if Conf.Exists("rate") {
+		err := Conf.Structure("rate", &cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Name == "" {
+		cfg.Name = "global"
+	}
+	err := cfg.check("")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rateRules{def: cfg.RatePolicy, policy: map[string]RatePolicy{}}
+	for prefix, p := range cfg.Parties {
+		if p.Name == "" {
+			p.Name = prefix
+		}
+		err = p.check(prefix)
+		if err != nil {
+			return nil, err
+		}
+		r.policy[prefix] = p
+		r.parties = append(r.parties, prefix)
+	}
+	// 最长前缀优先
+	sort.Slice(r.parties, func(i, j int) bool {
+		return len(r.parties[i]) > len(r.parties[j])
+	})
+	return r, nil
+}
+
+func (s *rateRules) match(path string) RatePolicy {
+	for _, prefix := range s.parties {
+		if hasPathPrefix(path, prefix) {
+			return s.policy[prefix]
+		}
+	}
+	return s.def
+}
+
+// MemoryRateStore 内存限流存储，每分钟清理过期的记录
+type MemoryRateStore struct {
+	mu      sync.Mutex
+	entries map[string]*rateEntry
+	swept   time.Time
+}
+
+type rateEntry struct {
+	tokens float64
+	last   time.Time
+	hits   []time.Time
+	expire time.Time
+}
+
+func NewMemoryRateStore() *MemoryRateStore {
+	return &MemoryRateStore{entries: make(map[string]*rateEntry), swept: time.Now()}
+}
+
+func (s *MemoryRateStore) Allow(key string, p RatePolicy) (RateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) >= time.Minute {
+		s.swept = now
+		for k, e := range s.entries {
+			if now.After(e.expire) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	e := s.entries[key]
+	if e == nil {
+		e = &rateEntry{tokens: float64(p.burst()), last: now}
+		s.entries[key] = e
+	}
+	e.expire = now.Add(p.window())
+
+	if p.Algorithm == "window" {
+		return e.window(p, now), nil
+	}
+	return e.token(p, now), nil
+}
+
+// token 令牌桶，按 limit/window 的速率补充令牌
+func (s *rateEntry) token(p RatePolicy, now time.Time) RateResult {
+	burst := float64(p.burst())
+	rate := float64(p.Limit) / p.window().Seconds()
+
+	s.tokens = math.Min(burst, s.tokens+now.Sub(s.last).Seconds()*rate)
+	s.last = now
+
+	res := RateResult{Limit: p.Limit}
+	if s.tokens >= 1 {
+		s.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - s.tokens) / rate)
+	}
+	res.Remaining = int(s.tokens)
+	res.Reset = seconds((burst - s.tokens) / rate)
+	return res
+}
+
+// window 滑动窗口，记录窗口内每次请求的时间
+func (s *rateEntry) window(p RatePolicy, now time.Time) RateResult {
+	w := p.window()
+	i := 0
+	for i < len(s.hits) && now.Sub(s.hits[i]) >= w {
+		i++
+	}
+	s.hits = s.hits[i:]
+
+	res := RateResult{Limit: p.Limit}
+	if len(s.hits) < p.Limit {
+		s.hits = append(s.hits, now)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = s.hits[0].Add(w).Sub(now)
+	}
+	res.Remaining = p.Limit - len(s.hits)
+	res.Reset = s.hits[0].Add(w).Sub(now)
+	return res
+}
+
+func seconds(v float64) time.Duration {
+	return time.Duration(v * float64(time.Second))
+}
@@ -0,0 +1,138 @@
+package lama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestRateClientKey(t *testing.T) {
+	apiKey := func(ctx *context.Context) {
+		ctx.Values().Set(apiKeyInfoKey, &APIKeyInfo{ID: "k1"})
+		ctx.Next()
+	}
+	user := func(ctx *context.Context) {
+		ctx.Values().Set(userIDKey, "u1")
+		ctx.Next()
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		auth context.Handler
+		want string
+	}{
+		{"ip", "", nil, "ip:192.0.2.1"},
+		{"apikey", "apikey", apiKey, "apikey:k1"},
+		{"apikey header only", "apikey", nil, "ip:192.0.2.1"},
+		{"user", "user", user, "user:u1"},
+		{"user missing", "user", nil, "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("X-API-Key", "lk_spoofed_secret")
+
+			var got string
+			handlers := []context.Handler{}
+			if tt.auth != nil {
+				handlers = append(handlers, tt.auth)
+			}
+			handlers = append(handlers, func(ctx *context.Context) {
+				got = RatePolicy{Key: tt.key}.clientKey(ctx)
+				ctx.Next()
+			})
+			testServe(req, handlers...)
+
+			if got != tt.want {
+				t.Errorf("clientKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	old := rateStore
+	rateStore = NewMemoryRateStore()
+	t.Cleanup(func() {
+		rateStore = old
+	})
+
+	h := RateLimit(RatePolicy{Limit: 1, Window: 60, Burst: 3})
+	tests := []struct {
+		status    int
+		remaining string
+	}{
+		{http.StatusOK, "1"},
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := testServe(req, h)
+		if rec.Code != tt.status {
+			t.Fatalf("request %d: status = %d, want %d", i, rec.Code, tt.status)
+		}
+		if v := rec.Header().Get("RateLimit-Limit"); v != "1" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want 1", i, v)
+		}
+		if v := rec.Header().Get("RateLimit-Remaining"); v != tt.remaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %s", i, v, tt.remaining)
+		}
+	}
+}
+
+func TestLoadRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		ok     bool
+	}{
+		{"default", nil, true},
+		{"ip", map[string]any{"rate.limit": 10, "rate.key": "ip"}, true},
+		{"apikey", map[string]any{"rate.limit": 10, "rate.key": "apikey"}, false},
+		{"party user", map[string]any{"rate.parties./api.limit": 10, "rate.parties./api.key": "user"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConf(t, tt.values)
+			_, err := loadRate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("loadRate() err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRateMatch(t *testing.T) {
+	testConf(t, map[string]any{
+		"rate.limit":                 100,
+		"rate.parties./api.limit":    10,
+		"rate.parties./api/v2.limit": 5,
+	})
+	rules, err := loadRate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/", 100},
+		{"/api", 10},
+		{"/api/users", 10},
+		{"/apix", 100},
+		{"/api/v2/users", 5},
+		{"/api/v20", 10},
+	}
+	for _, tt := range tests {
+		if got := rules.match(tt.path).Limit; got != tt.want {
+			t.Errorf("match(%q).Limit = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
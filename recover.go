@@ -1,9 +1,9 @@
 package lama
 
 import (
-	"github.com/gookit/validate"
+	"runtime/debug"
+
 	"github.com/kataras/iris/v12/context"
-	"time"
 )
 
 type Recover struct {
@@ -11,43 +11,34 @@ type Recover struct {
 }
 
 func (s *Recover) Init(app IRISApp) error {
+	err := Conf.Define("report", ReportConf{})
+	if err != nil {
+		return err
+	}
+
 	app.UseGlobal(func(ctx *context.Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				if ctx.IsStopped() { // handled by other middleware.
-					return
-				}
-
-				var code int
-				var msg string
-				ret := map[string]any{
-					"state": false,
-					"time":  time.Now().Unix(),
+			if v := recover(); v != nil {
+				err := toError(v, s.debug)
+				// 全部 panic 都记录调用栈，日志级别按状态码
+				logError(ctx, err, debug.Stack())
+				// 已输出响应时只记录
+				if !ctx.IsStopped() {
+					writeError(ctx, err, s.debug)
 				}
-
-				switch e := err.(type) {
-				case string:
-					code = 400
-					msg = e
-
-				case validate.Errors:
-					code = 400
-					msg = e.One()
-
-				default:
-					code = 500
-					msg = "Server internal error"
-					if s.debug {
-						// todo 优化
-						msg = err.(error).Error()
-					}
-				}
-
-				ret["msg"] = msg
-				ctx.StopWithJSON(code, ret)
 			}
 		}()
 		ctx.Next()
 	})
+
+	// 渲染 MVC 控制器返回的错误
+	app.OnAnyErrorCode(func(ctx *context.Context) {
+		if err := ctx.GetErr(); err != nil {
+			renderError(ctx, statusError(err, ctx.GetStatusCode(), s.debug), s.debug, nil)
+			return
+		}
+		code := ctx.GetStatusCode()
+		renderError(ctx, NewError(code, "", ""), s.debug, nil)
+	})
 	return nil
 }
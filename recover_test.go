@@ -0,0 +1,96 @@
+package lama
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type testReporter struct {
+	mu      sync.Mutex
+	reports []*ErrorReport
+}
+
+func (s *testReporter) Report(r *ErrorReport) {
+	s.mu.Lock()
+	s.reports = append(s.reports, r)
+	s.mu.Unlock()
+}
+
+func TestRecover(t *testing.T) {
+	testConf(t, nil)
+	var buf bytes.Buffer
+	Print.SetOutput(&buf)
+	t.Cleanup(func() {
+		Print.SetOutput(os.Stdout)
+	})
+	rep := &testReporter{}
+	old := reporter
+	reporter = rep
+	t.Cleanup(func() {
+		reporter = old
+	})
+
+	app := iris.New()
+	app.Logger().SetLevel("disable")
+	err := (&Recover{}).Init(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Get("/bad", func(ctx *context.Context) {
+		panic(BadRequest("bad input"))
+	})
+	app.Get("/boom", func(ctx *context.Context) {
+		panic(errors.New("boom"))
+	})
+	err = app.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		level  string
+	}{
+		{"/bad", 400, "[INFO]"},
+		{"/boom", 500, "[ERRO]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			buf.Reset()
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			out := buf.String()
+			if !strings.Contains(out, tt.level) || !strings.Contains(out, "runtime/debug.Stack") {
+				t.Errorf("log = %q, want %s with stack", out, tt.level)
+			}
+		})
+	}
+
+	// 并发的 5xx 上报
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/boom", nil))
+		}()
+	}
+	wg.Wait()
+	if n := len(rep.reports); n != 9 {
+		t.Errorf("reports = %d, want 9", n)
+	}
+}
@@ -0,0 +1,171 @@
+package lama
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+// ReportConf 配置[report]，默认错误上报写入的文件
+//
+// redact: 需要脱敏的请求参数和请求头，不区分大小写，默认见 defaultRedact
+type ReportConf struct {
+	Path       string   `json:"path"`
+	MaxSize    int      `json:"maxSize"`
+	MaxBackups int      `json:"maxBackups"`
+	Compress   bool     `json:"compress"`
+	Redact     []string `json:"redact"`
+}
+
+var defaultRedact = []string{
+	"authorization", "cookie", "set-cookie", "x-api-key",
+	"password", "passwd", "secret", "token", "access_token", "refresh_token", "api_key", "apikey",
+}
+
+// ErrorReport 错误上报内容，请求信息已脱敏
+type ErrorReport struct {
+	Time      time.Time         `json:"time"`
+	Service   string            `json:"service"`
+	RequestID string            `json:"requestId"`
+	Route     string            `json:"route"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Query     map[string]string `json:"query,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	IP        string            `json:"ip"`
+	Status    int               `json:"status"`
+	Code      string            `json:"code,omitempty"`
+	Msg       string            `json:"msg"`
+	Error     string            `json:"error"`
+	Panic     bool              `json:"panic"`
+	Stack     string            `json:"stack,omitempty"`
+}
+
+// ErrorReporter 错误上报接口，服务通过 Provide() ErrorReporter 提供，未提供时使用 FileReporter
+type ErrorReporter interface {
+	Report(r *ErrorReport)
+}
+
+// reporter 在声明时设置默认值，Act.Init 在启动前替换，请求中只读
+var reporter ErrorReporter = &FileReporter{}
+
+// report 上报 5xx 错误，stack 为 nil 时表示非 panic
+func report(ctx *context.Context, err *Error, stack []byte) {
+	if err.Status < 500 {
+		return
+	}
+	reporter.Report(newErrorReport(ctx, err, stack))
+}
+
+func newErrorReport(ctx *context.Context, err *Error, stack []byte) *ErrorReport {
+	r := &ErrorReport{
+		Time:      time.Now(),
+		Service:   Conf.String("app.name"),
+		RequestID: requestid.Get(ctx),
+		Method:    ctx.Method(),
+		Path:      ctx.Path(),
+		Query:     redactQuery(ctx.Request().URL.Query()),
+		Headers:   make(map[string]string),
+		IP:        ctx.RemoteAddr(),
+		Status:    err.Status,
+		Code:      err.Code,
+		Msg:       err.Msg,
+		Error:     err.Error(),
+		Panic:     stack != nil,
+		Stack:     string(stack),
+	}
+	if route := ctx.GetCurrentRoute(); route != nil {
+		r.Route = route.Path()
+	}
+	for k, v := range ctx.Request().Header {
+		r.Headers[k] = redactValue(k, strings.Join(v, ","))
+	}
+	return r
+}
+
+func redactQuery(q url.Values) map[string]string {
+	if len(q) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(q))
+	for k, v := range q {
+		out[k] = redactValue(k, strings.Join(v, ","))
+	}
+	return out
+}
+
+func redactValue(key, value string) string {
+	keys := Conf.Strings("report.redact")
+	if len(keys) == 0 {
+		keys = defaultRedact
+	}
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return "***"
+		}
+	}
+	return value
+}
+
+// FileReporter 以 JSON 行写入本地文件，默认 logs/error.log
+type FileReporter struct {
+	mu   sync.Mutex
+	file *RotateFile
+}
+
+func (s *FileReporter) Report(r *ErrorReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		f, err := s.open()
+		if err != nil {
+			Print.Errorf("Error Report %v", err)
+			return
+		}
+		s.file = f
+	}
+
+	data, err := json.Marshal(r)
+	if err == nil {
+		_, err = s.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		Print.Errorf("Error Report %v", err)
+	}
+}
+
+func (s *FileReporter) open() (*RotateFile, error) {
+	var cfg ReportConf
+	if Conf.Exists("report") {
+		err := Conf.Structure("report", &cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Path == "" {
+		cfg.Path = "logs/error.log"
+	}
+	return OpenRotateFile(SinkConf{
+		Type:       "file",
+		Path:       cfg.Path,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	})
+}
+
+func (s *FileReporter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,75 @@
+package lama
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+// Response 成功响应 {state:true,data,time,requestId}，可作为 MVC 控制器返回值
+type Response struct {
+	Status int
+	Data   any
+}
+
+// Success 返回 200 成功响应
+func Success(data any) *Response {
+	return &Response{Status: http.StatusOK, Data: data}
+}
+
+// Paged 返回分页成功响应，data 为 {list,total}
+func Paged(rows any, total int64) *Response {
+	v := reflect.ValueOf(rows)
+	if rows == nil || (v.Kind() == reflect.Slice && v.IsNil()) {
+		rows = []any{}
+	}
+	return Success(map[string]any{
+		"list":  rows,
+		"total": total,
+	})
+}
+
+// WithStatus 返回设置了状态码的副本
+func (s *Response) WithStatus(status int) *Response {
+	r := *s
+	r.Status = status
+	return &r
+}
+
+// Dispatch 输出响应，实现 hero.Result
+func (s *Response) Dispatch(ctx *context.Context) {
+	status := s.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ctx.StatusCode(status)
+	ctx.JSON(map[string]any{
+		"state":     true,
+		"data":      s.Data,
+		"time":      time.Now().Unix(),
+		"requestId": requestid.Get(ctx),
+	})
+}
+
+// OK 输出 200 成功响应
+func OK(ctx *context.Context, data any) {
+	Success(data).Dispatch(ctx)
+}
+
+// Created 输出 201 成功响应
+func Created(ctx *context.Context, data any) {
+	Success(data).WithStatus(http.StatusCreated).Dispatch(ctx)
+}
+
+// Page 输出分页成功响应
+func Page(ctx *context.Context, rows any, total int64) {
+	Paged(rows, total).Dispatch(ctx)
+}
+
+// Fail 按 Recover 的错误格式输出错误
+func Fail(ctx *context.Context, err error) {
+	renderError(ctx, err, Conf.Bool("app.debug"), nil)
+}
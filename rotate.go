@@ -0,0 +1,232 @@
+package lama
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SinkConf 日志输出配置
+type SinkConf struct {
+	Type       string `json:"type"`
+	Path       string `json:"path"`
+	MaxSize    int    `json:"maxSize"`
+	Rotate     string `json:"rotate"`
+	MaxBackups int    `json:"maxBackups"`
+	Compress   bool   `json:"compress"`
+}
+
+// RotateFile 按大小(MB)或按天切割的日志文件，打开失败后在下次写入时重试
+type RotateFile struct {
+	mu     sync.Mutex
+	cmu    sync.Mutex
+	cfg    SinkConf
+	file   *os.File
+	size   int64
+	day    string
+	closed bool
+}
+
+func OpenRotateFile(cfg SinkConf) (*RotateFile, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("log sink: path is empty")
+	}
+	if !filepath.IsAbs(cfg.Path) {
+		cfg.Path = filepath.Join(GetWorkerDir(), cfg.Path)
+	}
+
+	s := &RotateFile{cfg: cfg}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *RotateFile) open() error {
+	err := os.MkdirAll(filepath.Dir(s.cfg.Path), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.day = info.ModTime().Format("20060102")
+	if s.size == 0 {
+		s.day = time.Now().Format("20060102")
+	}
+	return nil
+}
+
+func (s *RotateFile) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+	if s.file == nil {
+		err := s.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if s.shouldRotate(len(p)) {
+		err := s.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *RotateFile) shouldRotate(n int) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.cfg.MaxSize > 0 && s.size+int64(n) > int64(s.cfg.MaxSize)<<20 {
+		return true
+	}
+	return s.cfg.Rotate == "day" && time.Now().Format("20060102") != s.day
+}
+
+func (s *RotateFile) rotate() error {
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+
+	name := s.cfg.Path + "." + time.Now().Format("20060102-150405")
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%s.%d", s.cfg.Path, time.Now().Format("20060102-150405"), i)
+	}
+
+	err = os.Rename(s.cfg.Path, name)
+	if err != nil {
+		return err
+	}
+
+	go s.cleanup(name)
+	return s.open()
+}
+
+// cleanup 压缩切割后的文件并删除超出保留数量的旧文件
+func (s *RotateFile) cleanup(name string) {
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+
+	if s.cfg.Compress {
+		err := gzipFile(name)
+		if err != nil {
+			Print.Errorf("Log Compress %s %v", name, err)
+		}
+	}
+
+	if s.cfg.MaxBackups <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(s.cfg.Path + ".*")
+	if err != nil {
+		return
+	}
+
+	var files []string
+	for _, f := range matches {
+		if !strings.HasSuffix(f, ".tmp") {
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	for len(files) > s.cfg.MaxBackups {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+// Reopen 重新打开日志文件，配合外部 logrotate 使用
+func (s *RotateFile) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	return s.open()
+}
+
+func (s *RotateFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(name + ".gz.tmp")
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(name + ".gz.tmp")
+		return err
+	}
+
+	err = os.Rename(name+".gz.tmp", name+".gz")
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
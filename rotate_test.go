@@ -0,0 +1,115 @@
+package lama
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// backups 返回切割后的文件
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	files, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestRotateFile(t *testing.T) {
+	line := append(bytes.Repeat([]byte("x"), 1023), '\n')
+
+	tests := []struct {
+		name    string
+		cfg     SinkConf
+		prepare func(f *RotateFile)
+		writes  int
+		backups int
+	}{
+		{"no rotate", SinkConf{}, nil, 1100, 0},
+		{"size", SinkConf{MaxSize: 1}, nil, 1100, 1},
+		{"size not reached", SinkConf{MaxSize: 1}, nil, 1000, 0},
+		{"day", SinkConf{Rotate: "day"}, func(f *RotateFile) { f.day = "20000101" }, 2, 1},
+		{"same day", SinkConf{Rotate: "day"}, nil, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Type = "file"
+			tt.cfg.Path = filepath.Join(t.TempDir(), "app.log")
+			f, err := OpenRotateFile(tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			_, err = f.Write(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(f)
+			}
+			for i := 1; i < tt.writes; i++ {
+				_, err = f.Write(line)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := backups(t, tt.cfg.Path); len(got) != tt.backups {
+				t.Fatalf("backups = %v, want %d", got, tt.backups)
+			}
+			info, err := os.Stat(tt.cfg.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total := int64(tt.writes * len(line)); tt.backups == 0 && info.Size() != total {
+				t.Errorf("size = %d, want %d", info.Size(), total)
+			}
+		})
+	}
+}
+
+func TestRotateFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := OpenRotateFile(SinkConf{Type: "file", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// 路径被目录占用时打开失败，之后恢复时写入重新打开文件
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(path, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Reopen() == nil {
+		t.Fatal("Reopen() err = nil, want error")
+	}
+	if _, err = f.Write([]byte("lost\n")); err == nil {
+		t.Fatal("Write() err = nil, want error")
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("ok\n"))
+	if err != nil {
+		t.Fatalf("Write() after recovery err = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "ok\n" {
+		t.Fatalf("file = %q, %v, want ok", data, err)
+	}
+
+	f.Close()
+	if _, err = f.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Fatalf("Write() after Close err = %v, want %v", err, os.ErrClosed)
+	}
+}
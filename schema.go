@@ -0,0 +1,401 @@
+package lama
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	gookit "github.com/gookit/config/v2"
+)
+
+// AppConf 配置[app]
+type AppConf struct {
+	Name          string  `json:"name"`
+	Addr          string  `json:"addr"`
+	Version       string  `json:"version"`
+	Debug         bool    `json:"debug"`
+	Recover       bool    `json:"recover"`
+	Accesslog     bool    `json:"accesslog"`
+	LogLevel      string  `json:"logLevel"`
+	LogFormat     string  `json:"logFormat"`
+	ShowSql       bool    `json:"showSql"`
+	SlowRequest   int     `json:"slowRequest"`
+	Timeout       int     `json:"timeout"`
+	Watch         bool    `json:"watch"`
+	WatchInterval int     `json:"watchInterval"`
+	WatchDebounce int     `json:"watchDebounce"`
+	StrictConfig  bool    `json:"strictConfig"`
+	ErrorStyle    string  `json:"errorStyle"`
+	ProblemType   string  `json:"problemType"`
+	TLS           TLSConf `json:"tls"`
+	Unix          string  `json:"unix"`
+	Admin         string  `json:"admin"`
+}
+
+// openSections 允许未知键的配置段，应用常在其中放自己的配置，app.strictConfig 开启时同样严格校验
+var openSections = map[string]bool{"app": true}
+
+func init() {
+	RegisterCommand(Command{
+		Name:  "schema",
+		Usage: "print JSON Schema of the config",
+		Run: func(args []string) error {
+			b, err := Conf.JSONSchema()
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		},
+	})
+}
+
+// Define 注册配置段的类型，立即校验当前配置，并在重载和 Validate 时严格校验
+func (s *Config) Define(key string, typ any) error {
+	s.define(key, typ)
+	return s.checkSection(s, key)
+}
+
+// define 只注册配置段的类型，校验推迟到 Validate，用于包初始化时注册的配置段
+func (s *Config) define(key string, typ any) {
+	t := reflect.TypeOf(typ)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	s.dmu.Lock()
+	if s.defs == nil {
+		s.defs = make(map[string]reflect.Type)
+	}
+	_, exists := s.defs[key]
+	s.defs[key] = t
+	s.dmu.Unlock()
+
+	if !exists {
+		s.Check(func(c Cfg) error {
+			return s.checkSection(c, key)
+		})
+	}
+}
+
+// deferError 记录包初始化时的配置错误，由 Validate 报告
+func (s *Config) deferError(err error) {
+	s.mu.Lock()
+	s.errs = append(s.errs, err)
+	s.mu.Unlock()
+}
+
+// Validate 执行全部配置校验，app.strictConfig 开启时未注册的配置段也视为错误
+func (s *Config) Validate() error {
+	s.mu.Lock()
+	checks := append([]CheckFn{}, s.checks...)
+	errs := append([]error{}, s.errs...)
+	s.mu.Unlock()
+
+	for _, fn := range checks {
+		err := fn(s)
+		if err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	if s.Bool("app.strictConfig") {
+		for _, key := range sortedKeys(s.Data()) {
+			s.dmu.RLock()
+			_, ok := s.defs[key]
+			s.dmu.RUnlock()
+			if !ok {
+				return &SchemaError{File: s.source(key), Path: key, Msg: "unknown key"}
+			}
+		}
+	}
+	return nil
+}
+
+// JSONSchema 根据注册的配置类型生成 JSON Schema
+func (s *Config) JSONSchema() ([]byte, error) {
+	s.dmu.RLock()
+	props := make(map[string]any, len(s.defs))
+	for key, t := range s.defs {
+		ts := typeSchema(t)
+		if openSections[key] && !s.Bool("app.strictConfig") {
+			ts["additionalProperties"] = true
+		}
+		props[key] = ts
+	}
+	s.dmu.RUnlock()
+
+	schema := map[string]any{
+		"$schema":    "http://json-schema.org/draft-07/schema#",
+		"title":      s.Name(),
+		"type":       "object",
+		"properties": props,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func (s *Config) checkSection(c Cfg, key string) error {
+	s.dmu.RLock()
+	t := s.defs[key]
+	s.dmu.RUnlock()
+
+	val, ok := c.Data()[key]
+	if !ok || t == nil {
+		return nil
+	}
+	// 未开启 app.strictConfig 时忽略开放配置段中的未知键
+	if m, isMap := val.(map[string]any); isMap && openSections[key] && !c.Bool("app.strictConfig") {
+		fields := structFields(t)
+		known := make(map[string]any, len(m))
+		for k, v := range m {
+			if _, ok := fields[k]; ok {
+				known[k] = v
+			}
+		}
+		val = known
+	}
+
+	path, msg := checkValue(key, val, t)
+	if msg == "" {
+		return nil
+	}
+	return &SchemaError{File: s.source(path), Path: path, Msg: msg}
+}
+
+// source 查找定义了该键的配置文件
+func (s *Config) source(path string) string {
+	var file string
+	for _, f := range s.Files() {
+		c := newConfig(gookit.New(s.Name()))
+		if c.LoadFiles(f) != nil {
+			continue
+		}
+		if _, ok := c.GetValue(path); ok {
+			file = f
+		}
+	}
+	return file
+}
+
+// SchemaError 配置不符合注册的类型
+type SchemaError struct {
+	File string
+	Path string
+	Msg  string
+}
+
+func (s *SchemaError) Error() string {
+	if s.File == "" {
+		return fmt.Sprintf("config[%s]: %s", s.Path, s.Msg)
+	}
+	return fmt.Sprintf("config %s[%s]: %s", s.File, s.Path, s.Msg)
+}
+
+func checkValue(path string, val any, t reflect.Type) (string, string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if val == nil {
+		return "", ""
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return "", ""
+
+	case reflect.Struct:
+		m, ok := val.(map[string]any)
+		if !ok {
+			return path, typeMsg(t, val)
+		}
+		fields := structFields(t)
+		for _, k := range sortedKeys(m) {
+			f, ok := fields[k]
+			if !ok {
+				msg := "unknown key"
+				for name := range fields {
+					if strings.EqualFold(name, k) {
+						msg += fmt.Sprintf(", did you mean %q", name)
+						break
+					}
+				}
+				return path + "." + k, msg
+			}
+			if p, msg := checkValue(path+"."+k, m[k], f.Type); msg != "" {
+				return p, msg
+			}
+		}
+
+	case reflect.Map:
+		m, ok := val.(map[string]any)
+		if !ok {
+			return path, typeMsg(t, val)
+		}
+		for _, k := range sortedKeys(m) {
+			if p, msg := checkValue(path+"."+k, m[k], t.Elem()); msg != "" {
+				return p, msg
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		l, ok := val.([]any)
+		if !ok {
+			return path, typeMsg(t, val)
+		}
+		for i, v := range l {
+			if p, msg := checkValue(fmt.Sprintf("%s.%d", path, i), v, t.Elem()); msg != "" {
+				return p, msg
+			}
+		}
+
+	case reflect.String:
+		if _, ok := val.(string); !ok {
+			return path, typeMsg(t, val)
+		}
+
+	case reflect.Bool:
+		if _, ok := val.(bool); !ok {
+			return path, typeMsg(t, val)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch v := val.(type) {
+		case int, int64:
+		case float64:
+			if v != math.Trunc(v) {
+				return path, typeMsg(t, val)
+			}
+		default:
+			return path, typeMsg(t, val)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		switch val.(type) {
+		case int, int64, float64:
+		default:
+			return path, typeMsg(t, val)
+		}
+	}
+
+	return "", ""
+}
+
+func typeMsg(t reflect.Type, val any) string {
+	return fmt.Sprintf("expected %s, got %s", schemaType(t), jsonType(val))
+}
+
+func jsonType(val any) string {
+	switch val.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, float64:
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+func schemaType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaType(t.Elem())
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	}
+	return ""
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	schema := map[string]any{}
+	if typ := schemaType(t); typ != "" {
+		schema["type"] = typ
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		for name, f := range structFields(t) {
+			props[name] = typeSchema(f.Type)
+			if strings.Contains(f.Tag.Get("validate"), "required") {
+				required = append(required, name)
+			}
+		}
+		sort.Strings(required)
+		schema["properties"] = props
+		schema["additionalProperties"] = false
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+
+	case reflect.Map:
+		schema["additionalProperties"] = typeSchema(t.Elem())
+
+	case reflect.Slice, reflect.Array:
+		schema["items"] = typeSchema(t.Elem())
+	}
+
+	return schema
+}
+
+func structFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for k, v := range structFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
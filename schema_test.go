@@ -0,0 +1,41 @@
+package lama
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateAppKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]any
+		ok     bool
+	}{
+		{"known", map[string]any{"app.addr": ":8080"}, true},
+		{"wrong type", map[string]any{"app.addr": 8080}, false},
+		{"user key", map[string]any{"app.feature": "x"}, true},
+		{"user key strict", map[string]any{"app.feature": "x", "app.strictConfig": true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConf(t, tt.values)
+			Conf.define("app", AppConf{})
+			err := Conf.Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("Validate() err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidateDeferredError(t *testing.T) {
+	testConf(t, nil)
+	want := &SchemaError{Path: "log", Msg: "open /nope/app.log: permission denied"}
+	Conf.deferError(want)
+
+	var se *SchemaError
+	err := Conf.Validate()
+	if !errors.As(err, &se) || se != want {
+		t.Fatalf("Validate() err = %v, want %v", err, want)
+	}
+}
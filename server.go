@@ -32,6 +32,7 @@ func NewSrv() *Srv {
 	return &Srv{
 		services: []any{
 			&provide{},
+			&CfgWatch{},
 		},
 	}
 }
@@ -59,6 +60,17 @@ func (s *Srv) Run() {
 		Print.Fatal(err)
 	}
 
+	// 校验配置，服务在 Init 中注册的配置段也参与校验
+	err = Conf.Validate()
+	if err != nil {
+		Print.Fatal(err)
+	}
+
+	// 执行子命令
+	if runCommand(app) {
+		return
+	}
+
 	// 启动服务
 	errCh := app.Serve()
 
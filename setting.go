@@ -0,0 +1,140 @@
+package lama
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SettingConf 配置[setting]
+type SettingConf struct {
+	Table    string `json:"table"`
+	Interval int    `json:"interval"`
+	Notify   string `json:"notify"`
+}
+
+// Setting 从 Postgres 表读取动态配置并覆盖在文件配置之上
+//
+//	CREATE TABLE settings (key TEXT PRIMARY KEY, value TEXT NOT NULL)
+//
+// value 按 JSON 解析，失败时作为字符串
+type Setting struct {
+	cfg      SettingConf
+	db       *Database
+	pg       *PG
+	listener *pq.Listener
+	stop     chan struct{}
+	once     sync.Once
+}
+
+func (s *Setting) Init(db SqlxDB) error {
+	err := Conf.Define("setting", SettingConf{})
+	if err != nil {
+		return err
+	}
+
+	if Conf.Exists("setting") {
+		err = Conf.Structure("setting", &s.cfg)
+		if err != nil {
+			return err
+		}
+	}
+	if s.cfg.Table == "" {
+		s.cfg.Table = "settings"
+	}
+	if s.cfg.Interval <= 0 {
+		s.cfg.Interval = 30
+	}
+
+	s.db = &Database{db: db}
+	s.pg = PGOf(db)
+	return s.Refresh()
+}
+
+// Refresh 重新读取动态配置
+func (s *Setting) Refresh() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = er
+			} else {
+				panic(e)
+			}
+		}
+	}()
+
+	values := make(map[string]any)
+	rows := s.db.Select(s.cfg.Table, func(sel *Sql, where *Sql) {
+		sel.Space("key,value")
+	})
+	for _, row := range rows {
+		var val any
+		raw := row.Get("value").String()
+		if json.Unmarshal([]byte(raw), &val) != nil {
+			val = raw
+		}
+		values[row.Get("key").String()] = val
+	}
+
+	return Conf.Overlay("setting", values)
+}
+
+func (s *Setting) Serve() chan error {
+	errCh := make(chan error)
+	stop := make(chan struct{})
+	s.stop = stop
+
+	var notify <-chan *pq.Notification
+	if s.cfg.Notify != "" && s.pg == nil {
+		Print.Errorf("Setting Listen %s: db is not provided by PG", s.cfg.Notify)
+	} else if s.cfg.Notify != "" {
+		l, err := s.pg.Listener(s.cfg.Notify)
+		if err != nil {
+			Print.Errorf("Setting Listen %s %v", s.cfg.Notify, err)
+		} else {
+			s.listener = l
+			notify = l.NotificationChannel()
+		}
+	}
+
+	go func() {
+		defer close(errCh)
+		ticker := time.NewTicker(time.Duration(s.cfg.Interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			case _, ok := <-notify:
+				// 监听关闭后 channel 一直可读，改为只按间隔刷新
+				if !ok {
+					notify = nil
+					continue
+				}
+			}
+
+			err := s.Refresh()
+			if err != nil {
+				Print.Errorf("Setting Refresh Failed %v", err)
+			}
+		}
+	}()
+
+	return errCh
+}
+
+func (s *Setting) Stop() error {
+	s.once.Do(func() {
+		if s.stop != nil {
+			close(s.stop)
+		}
+	})
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
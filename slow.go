@@ -0,0 +1,29 @@
+package lama
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+var slowRequests atomic.Int64
+var slowQueries atomic.Int64
+
+// slowRequest 请求耗时超过 app.slowRequest(毫秒)时告警
+func slowRequest(ctx *context.Context) {
+	start := time.Now()
+	ctx.Next()
+
+	slow := time.Duration(Conf.Int("app.slowRequest")) * time.Millisecond
+	dur := time.Since(start)
+	if slow <= 0 || dur < slow {
+		return
+	}
+
+	slowRequests.Add(1)
+	Logger(ctx).Warnf("Slow Request %s %s %s", ctx.Method(), ctx.Path(), dur, Fields{
+		"status":   ctx.GetStatusCode(),
+		"duration": dur.Milliseconds(),
+	})
+}
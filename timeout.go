@@ -0,0 +1,58 @@
+package lama
+
+import (
+	stdContext "context"
+	"errors"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+// baseContextKey 超时前的请求 context，路由的超时从它派生，可以比全局超时更长
+type baseContextKey struct{}
+
+// requestTimeout 按 app.timeout(毫秒)为请求设置超时，为 0 时不限制
+func requestTimeout(ctx *context.Context) {
+	d := time.Duration(Conf.Int("app.timeout")) * time.Millisecond
+	if d <= 0 {
+		ctx.Next()
+		return
+	}
+	withTimeout(ctx, d)
+}
+
+// Timeout 为路由组或路由设置超时，覆盖 app.timeout
+//
+//	party.Get("/report", lama.Timeout(30*time.Second), handler)
+//
+// 超时是协作式的: 只取消请求 context，使用 DB.WithContext(ctx) 的查询随之取消，不会中断处理函数
+//
+// 504 在处理函数返回后输出，处理函数已输出响应或设置了状态码时不覆盖；
+// 不响应 context 取消的处理函数(如不带 context 的外部调用、sleep)会一直占用请求直到返回，
+// 这类调用需自行使用 ctx.Request().Context()
+func Timeout(d time.Duration) context.Handler {
+	return func(ctx *context.Context) {
+		withTimeout(ctx, d)
+	}
+}
+
+func withTimeout(ctx *context.Context, d time.Duration) {
+	base, ok := ctx.Value(baseContextKey{}).(stdContext.Context)
+	if !ok {
+		base = ctx.Request().Context()
+	}
+
+	c, cancel := stdContext.WithTimeout(base, d)
+	defer cancel()
+	ctx.ResetRequest(ctx.Request().WithContext(stdContext.WithValue(c, baseContextKey{}, base)))
+	status := ctx.GetStatusCode()
+	ctx.Next()
+
+	// 处理函数已输出响应(包括查询取消后的错误)或设置了状态码(如 204 没有响应体)时不再输出
+	if ctx.ResponseWriter().Written() != context.NoWritten || ctx.GetStatusCode() != status {
+		return
+	}
+	if errors.Is(c.Err(), stdContext.DeadlineExceeded) {
+		renderError(ctx, GatewayTimeout("request timed out"), false, nil)
+	}
+}
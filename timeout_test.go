@@ -0,0 +1,46 @@
+package lama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+)
+
+func TestTimeout(t *testing.T) {
+	testConf(t, nil)
+	wait := func(ctx *context.Context) {
+		<-ctx.Request().Context().Done()
+	}
+
+	tests := []struct {
+		name    string
+		handler context.Handler
+		status  int
+	}{
+		{"timed out", wait, http.StatusGatewayTimeout},
+		{"status set", func(ctx *context.Context) {
+			wait(ctx)
+			ctx.StatusCode(http.StatusNoContent)
+		}, http.StatusNoContent},
+		{"written", func(ctx *context.Context) {
+			wait(ctx)
+			ctx.StatusCode(http.StatusCreated)
+			ctx.WriteString("created")
+		}, http.StatusCreated},
+		{"in time", func(ctx *context.Context) {
+			ctx.Next()
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := testServe(req, Timeout(10*time.Millisecond), tt.handler)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
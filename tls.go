@@ -0,0 +1,182 @@
+package lama
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TLSConf 配置[app.tls]
+//
+// minVersion: 1.0/1.1/1.2/1.3，默认 1.2
+// ciphers: 加密套件名称，如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，默认使用 Go 的设置
+// clientCA: 配置后要求客户端证书 (mTLS)
+// redirect: 将 HTTP 请求重定向到 HTTPS 的监听地址，如 :80
+type TLSConf struct {
+	Cert       string   `json:"cert"`
+	Key        string   `json:"key"`
+	MinVersion string   `json:"minVersion"`
+	Ciphers    []string `json:"ciphers"`
+	ClientCA   string   `json:"clientCA"`
+	Redirect   string   `json:"redirect"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig 创建 tls.Config，证书文件变化时在握手时重新加载
+func newTLSConfig(cfg TLSConf) (*tls.Config, error) {
+	for _, f := range []*string{&cfg.Cert, &cfg.Key, &cfg.ClientCA} {
+		if *f != "" && !filepath.IsAbs(*f) {
+			*f = filepath.Join(GetWorkerDir(), *f)
+		}
+	}
+
+	min := tls.VersionTLS12
+	if cfg.MinVersion != "" {
+		v, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown minVersion %s", cfg.MinVersion)
+		}
+		min = int(v)
+	}
+
+	var ciphers []uint16
+	for _, name := range cfg.Ciphers {
+		id, err := cipherSuite(name)
+		if err != nil {
+			return nil, err
+		}
+		ciphers = append(ciphers, id)
+	}
+
+	certs := &certLoader{cfg: cfg}
+	err := certs.load()
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion:   uint16(min),
+		CipherSuites: ciphers,
+	}
+	if cfg.ClientCA != "" {
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	conf := base.Clone()
+	conf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		cert, pool := certs.current()
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*cert}
+		c.ClientCAs = pool
+		return c, nil
+	}
+	return conf, nil
+}
+
+// cipherSuite 按名称查找加密套件，拒绝 tls.InsecureCipherSuites 中的套件
+func cipherSuite(name string) (uint16, error) {
+	for _, c := range tls.CipherSuites() {
+		if c.Name == name {
+			return c.ID, nil
+		}
+	}
+	for _, c := range tls.InsecureCipherSuites() {
+		if c.Name == name {
+			return 0, fmt.Errorf("tls: insecure cipher %s", name)
+		}
+	}
+	return 0, fmt.Errorf("tls: unknown cipher %s", name)
+}
+
+// certLoader 每秒最多检查一次证书文件，变化时重新加载，失败时继续使用旧证书
+type certLoader struct {
+	mu      sync.Mutex
+	cfg     TLSConf
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	stamp   string
+	checked time.Time
+}
+
+func (s *certLoader) files() []string {
+	files := []string{s.cfg.Cert, s.cfg.Key}
+	if s.cfg.ClientCA != "" {
+		files = append(files, s.cfg.ClientCA)
+	}
+	return files
+}
+
+func (s *certLoader) load() error {
+	stamp := fileStamp(s.files())
+
+	cert, err := tls.LoadX509KeyPair(s.cfg.Cert, s.cfg.Key)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if s.cfg.ClientCA != "" {
+		pem, err := os.ReadFile(s.cfg.ClientCA)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates in %s", s.cfg.ClientCA)
+		}
+	}
+
+	s.cert = &cert
+	s.pool = pool
+	s.stamp = stamp
+	return nil
+}
+
+func (s *certLoader) current() (*tls.Certificate, *x509.CertPool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) >= time.Second {
+		s.checked = time.Now()
+		if fileStamp(s.files()) != s.stamp {
+			err := s.load()
+			if err != nil {
+				Print.Errorf("TLS Reload Failed %v", err)
+			} else {
+				Print.Info("TLS Certificate Reloaded")
+			}
+		}
+	}
+	return s.cert, s.pool
+}
+
+// newRedirectServer 创建将 HTTP 请求重定向到 HTTPS 的服务，addr 为 HTTPS 监听地址
+func newRedirectServer(listen, addr string) *http.Server {
+	_, port, _ := net.SplitHostPort(addr)
+
+	return &http.Server{
+		Addr: listen,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(r.Host); err == nil {
+				host = h
+			}
+			if port != "" && port != "443" {
+				host = net.JoinHostPort(host, port)
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		}),
+	}
+}
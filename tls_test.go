@@ -0,0 +1,245 @@
+package lama
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert 生成证书写入 dir，parent 为空时自签名
+func newTestCert(t *testing.T, dir, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signCert, signKey := tpl, key
+	if parent == nil {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+	} else {
+		signCert, signKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, signCert, &key.PublicKey, signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	err = os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *testCert) tlsCert() []tls.Certificate {
+	return []tls.Certificate{{Certificate: [][]byte{s.cert.Raw}, PrivateKey: s.key}}
+}
+
+// testHandshake 在本地连接上握手，返回客户端或服务端的错误
+func testHandshake(t *testing.T, server, client *tls.Config) error {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		done <- tls.Server(conn, server).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), client)
+	if err == nil {
+		conn.Close()
+	}
+	if serr := <-done; err == nil {
+		err = serr
+	}
+	return err
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	srv := newTestCert(t, dir, "server", ca)
+
+	tests := []struct {
+		name string
+		cfg  TLSConf
+		ok   bool
+	}{
+		{"default", TLSConf{}, true},
+		{"cipher", TLSConf{Ciphers: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}, true},
+		{"insecure cipher", TLSConf{Ciphers: []string{"TLS_ECDHE_ECDSA_WITH_RC4_128_SHA"}}, false},
+		{"unknown cipher", TLSConf{Ciphers: []string{"TLS_FOO"}}, false},
+		{"unknown minVersion", TLSConf{MinVersion: "1.4"}, false},
+		{"missing clientCA", TLSConf{ClientCA: filepath.Join(dir, "none.crt")}, false},
+		{"invalid clientCA", TLSConf{ClientCA: srv.keyFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Cert, tt.cfg.Key = srv.certFile, srv.keyFile
+			_, err := newTLSConfig(tt.cfg)
+			if (err == nil) != tt.ok {
+				t.Fatalf("newTLSConfig() err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTLSHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	srv := newTestCert(t, dir, "server", ca)
+	client := newTestCert(t, dir, "client", ca)
+	other := newTestCert(t, dir, "other", nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name       string
+		minVersion string
+		clientCA   bool
+		maxVersion uint16
+		cert       *testCert
+		ok         bool
+	}{
+		{"default", "", false, 0, nil, true},
+		{"below default min", "", false, tls.VersionTLS11, nil, false},
+		{"min 1.3", "1.3", false, tls.VersionTLS12, nil, false},
+		{"min 1.3 ok", "1.3", false, tls.VersionTLS13, nil, true},
+		{"client cert required", "", true, 0, nil, false},
+		{"client cert", "", true, 0, client, true},
+		{"client cert 1.2", "", true, tls.VersionTLS12, client, true},
+		{"client cert untrusted", "", true, 0, other, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := TLSConf{Cert: srv.certFile, Key: srv.keyFile, MinVersion: tt.minVersion}
+			if tt.clientCA {
+				cfg.ClientCA = ca.certFile
+			}
+			conf, err := newTLSConfig(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cc := &tls.Config{
+				RootCAs:    roots,
+				ServerName: "localhost",
+				MinVersion: tls.VersionTLS10,
+				MaxVersion: tt.maxVersion,
+			}
+			if tt.cert != nil {
+				cc.Certificates = tt.cert.tlsCert()
+			}
+			err = testHandshake(t, conf, cc)
+			if (err == nil) != tt.ok {
+				t.Fatalf("handshake err = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCertLoader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	srv := newTestCert(t, dir, "server", ca)
+
+	s := &certLoader{cfg: TLSConf{Cert: srv.certFile, Key: srv.keyFile}}
+	err := s.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.checked = time.Now()
+
+	// 替换证书文件，检查间隔内继续使用旧证书
+	rotated := newTestCert(t, dir, "server", ca)
+	future := time.Now().Add(time.Minute)
+	for _, f := range []string{rotated.certFile, rotated.keyFile} {
+		err = os.Chtimes(f, future, future)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cert, _ := s.current(); !srv.cert.Equal(leaf(t, cert)) {
+		t.Fatal("current() within interval = rotated cert, want old cert")
+	}
+
+	s.checked = time.Time{}
+	if cert, _ := s.current(); !rotated.cert.Equal(leaf(t, cert)) {
+		t.Fatal("current() = old cert, want rotated cert")
+	}
+
+	// 新证书无效时继续使用当前证书
+	err = os.WriteFile(srv.certFile, []byte("invalid"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.checked = time.Time{}
+	if cert, _ := s.current(); !rotated.cert.Equal(leaf(t, cert)) {
+		t.Fatal("current() after invalid cert = other cert, want rotated cert")
+	}
+}
+
+func leaf(t *testing.T, cert *tls.Certificate) *x509.Certificate {
+	t.Helper()
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
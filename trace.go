@@ -0,0 +1,463 @@
+package lama
+
+import (
+	"bytes"
+	stdContext "context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12/context"
+	"github.com/kataras/iris/v12/middleware/requestid"
+)
+
+// TraceConf 配置[trace]
+//
+// exporter: stdout、file、otlp，为空时不导出 (除非服务提供了 SpanExporter)
+// path: file 导出的文件，默认 logs/trace.log
+// endpoint: OTLP/HTTP 地址，默认 http://localhost:4318/v1/traces
+// sample: 没有上游 traceparent 时的采样率 (0,1]，默认 1
+type TraceConf struct {
+	Exporter string            `json:"exporter"`
+	Path     string            `json:"path"`
+	Endpoint string            `json:"endpoint"`
+	Headers  map[string]string `json:"headers"`
+	Sample   float64           `json:"sample"`
+}
+
+// Span 追踪片段
+type Span struct {
+	TraceID  string         `json:"traceId"`
+	SpanID   string         `json:"spanId"`
+	ParentID string         `json:"parentSpanId,omitempty"`
+	Name     string         `json:"name"`
+	Kind     string         `json:"kind"`
+	Start    time.Time      `json:"start"`
+	End      time.Time      `json:"end"`
+	Attrs    map[string]any `json:"attributes,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Sampled  bool           `json:"-"`
+	mu       sync.Mutex
+}
+
+// SpanExporter 导出结束的 Span，服务通过 Provide() SpanExporter 提供
+type SpanExporter interface {
+	Export(spans []*Span) error
+}
+
+type spanKey struct{}
+
+type traceState struct {
+	once     sync.Once
+	mu       sync.Mutex
+	exporter SpanExporter
+	sample   float64
+	ch       chan *Span
+	flush    chan chan struct{}
+}
+
+// tracer 的通道在声明时创建，导出和 flush 并发读取时无需加锁
+var tracer = &traceState{
+	ch:    make(chan *Span, 4096),
+	flush: make(chan chan struct{}),
+}
+
+// initTracer 按配置[trace]创建导出器，exp 不为 nil 时优先使用
+func initTracer(exp SpanExporter) error {
+	var cfg TraceConf
+	err := Conf.Define("trace", TraceConf{})
+	if err == nil && Conf.Exists("trace") {
+		err = Conf.Structure("trace", &cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	if exp == nil {
+		switch cfg.Exporter {
+		case "":
+		case "stdout":
+			exp = &JSONExporter{w: os.Stdout}
+		case "file":
+			if cfg.Path == "" {
+				cfg.Path = "logs/trace.log"
+			}
+			f, err := OpenRotateFile(SinkConf{Type: "file", Path: cfg.Path})
+			if err != nil {
+				return err
+			}
+			exp = &JSONExporter{w: f}
+		case "otlp":
+			exp = &OTLPExporter{Endpoint: cfg.Endpoint, Headers: cfg.Headers}
+		default:
+			return fmt.Errorf("trace: unknown exporter %s", cfg.Exporter)
+		}
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	tracer.exporter = exp
+	tracer.sample = cfg.Sample
+	if tracer.sample <= 0 || tracer.sample > 1 {
+		tracer.sample = 1
+	}
+	return nil
+}
+
+func traceEnabled() bool {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	return tracer.exporter != nil
+}
+
+// exportSpan 批量导出，每秒或满 256 个时导出一次
+func exportSpan(span *Span) {
+	startTraceLoop()
+
+	select {
+	case tracer.ch <- span:
+	default: // 队列已满时丢弃
+	}
+}
+
+func startTraceLoop() {
+	tracer.once.Do(func() {
+		go traceLoop()
+	})
+}
+
+func traceLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var batch []*Span
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		tracer.mu.Lock()
+		exp := tracer.exporter
+		tracer.mu.Unlock()
+		if exp != nil {
+			err := exp.Export(batch)
+			if err != nil {
+				Print.Errorf("Trace Export Failed %v", err)
+			}
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-tracer.ch:
+			batch = append(batch, span)
+			if len(batch) >= 256 {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case done := <-tracer.flush:
+			for len(tracer.ch) > 0 {
+				batch = append(batch, <-tracer.ch)
+			}
+			send()
+			close(done)
+		}
+	}
+}
+
+// flushTraces 导出队列中剩余的 Span
+func flushTraces() {
+	startTraceLoop()
+	done := make(chan struct{})
+	select {
+	case tracer.flush <- done:
+		<-done
+	case <-time.After(5 * time.Second):
+	}
+}
+
+// SpanFrom 从 context 中取得当前 Span
+func SpanFrom(ctx stdContext.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan 返回带有 Span 的 context
+func ContextWithSpan(ctx stdContext.Context, span *Span) stdContext.Context {
+	if c, ok := ctx.(*context.Context); ok {
+		setRequestValue(c, spanKey{}, span)
+		return c
+	}
+	return stdContext.WithValue(ctx, spanKey{}, span)
+}
+
+// StartSpan 创建 ctx 中 Span 的子 Span，没有父 Span 时返回 nil
+func StartSpan(ctx stdContext.Context, name, kind string) *Span {
+	parent := SpanFrom(ctx)
+	if parent == nil {
+		return nil
+	}
+	return &Span{
+		TraceID:  parent.TraceID,
+		SpanID:   randomHex(8),
+		ParentID: parent.SpanID,
+		Name:     name,
+		Kind:     kind,
+		Start:    time.Now(),
+		Sampled:  parent.Sampled,
+	}
+}
+
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]any)
+	}
+	s.Attrs[key] = value
+}
+
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// Finish 结束并导出 Span
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	if s.End.IsZero() {
+		s.End = time.Now()
+	}
+	if s.Sampled && traceEnabled() {
+		exportSpan(s)
+	}
+}
+
+// Traceparent 返回 W3C traceparent，用于向下游传递
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags)
+}
+
+// parseTraceparent 解析 version-traceid-spanid-flags
+func parseTraceparent(h string) (traceID, spanID string, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+	if !isHex(parts[1]) || !isHex(parts[2]) || !isHex(parts[3]) {
+		return
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return
+	}
+	flags, _ := strconv.ParseUint(parts[3], 16, 8)
+	return parts[1], parts[2], flags&1 == 1, true
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceRequest 为每个请求创建 server Span，沿用请求头 traceparent
+func traceRequest(ctx *context.Context) {
+	if !traceEnabled() {
+		ctx.Next()
+		return
+	}
+
+	span := &Span{SpanID: randomHex(8), Kind: "server", Start: time.Now()}
+	if tid, pid, sampled, ok := parseTraceparent(ctx.GetHeader("traceparent")); ok {
+		span.TraceID, span.ParentID, span.Sampled = tid, pid, sampled
+	} else {
+		tracer.mu.Lock()
+		sample := tracer.sample
+		tracer.mu.Unlock()
+		span.TraceID = randomHex(16)
+		span.Sampled = mrand.Float64() < sample
+	}
+	ContextWithSpan(ctx, span)
+
+	ctx.Next()
+
+	route := ctx.Path()
+	if r := ctx.GetCurrentRoute(); r != nil {
+		route = r.Path()
+	}
+	span.Name = ctx.Method() + " " + route
+	span.SetAttr("http.method", ctx.Method())
+	span.SetAttr("http.route", route)
+	span.SetAttr("http.target", ctx.Request().URL.RequestURI())
+	span.SetAttr("http.status_code", ctx.GetStatusCode())
+	span.SetAttr("request.id", requestid.Get(ctx))
+	if ctx.GetStatusCode() >= 500 {
+		span.Error = http.StatusText(ctx.GetStatusCode())
+		if err := ctx.GetErr(); err != nil {
+			span.Error = err.Error()
+		}
+	}
+	span.Finish()
+}
+
+// JSONExporter 以 JSON lines 输出 Span
+type JSONExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+func (s *JSONExporter) Export(spans []*Span) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, span := range spans {
+		err := enc.Encode(span)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := s.w.Write(buf.Bytes())
+	return err
+}
+
+// OTLPExporter 以 OTLP/HTTP JSON 发送到 collector
+type OTLPExporter struct {
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+}
+
+var otlpKinds = map[string]int{"internal": 1, "server": 2, "client": 3}
+
+func (s *OTLPExporter) Export(spans []*Span) error {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "http://localhost:4318/v1/traces"
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	list := make([]map[string]any, 0, len(spans))
+	for _, span := range spans {
+		item := map[string]any{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              otlpKinds[span.Kind],
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttrs(span.Attrs),
+			"status":            map[string]any{"code": 1},
+		}
+		if span.ParentID != "" {
+			item["parentSpanId"] = span.ParentID
+		}
+		if span.Error != "" {
+			item["status"] = map[string]any{"code": 2, "message": span.Error}
+		}
+		list = append(list, item)
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttrs(map[string]any{"service.name": Conf.String("app.name")}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "lama"},
+				"spans": list,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp: %s", resp.Status)
+	}
+	return nil
+}
+
+func otlpAttrs(attrs map[string]any) []map[string]any {
+	list := make([]map[string]any, 0, len(attrs))
+	for k, v := range attrs {
+		var val map[string]any
+		switch x := v.(type) {
+		case string:
+			val = map[string]any{"stringValue": x}
+		case bool:
+			val = map[string]any{"boolValue": x}
+		case int:
+			val = map[string]any{"intValue": strconv.Itoa(x)}
+		case int64:
+			val = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			val = map[string]any{"doubleValue": x}
+		default:
+			val = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		list = append(list, map[string]any{"key": k, "value": val})
+	}
+	return list
+}